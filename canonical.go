@@ -0,0 +1,283 @@
+package march
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// The JSON Canonicalization Scheme (JCS) of RFC 8785 gives each JSON value a single byte-exact form,
+// so that marshaled values can be signed and hashed. See March.Canonical.
+
+// CanonicalJSON rewrites a JSON value in the canonical form of RFC 8785:
+// object members sorted by the UTF-16 code units of their names, numbers formatted as in ES6,
+// strings with minimal escaping, and no whitespace.
+// Objects with duplicate names, numbers which overflow float64, invalid UTF-8 and lone surrogates are errors, as RFC 8785 requires,
+// as are integers which float64 can not hold exactly (such as 9007199254740993), which would otherwise change value.
+func CanonicalJSON(data []byte) ([]byte, error) {
+	if err := checkUnicode(data); err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	out, err := appendCanonical(nil, dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("Unexpected data after the value at offset %d", dec.InputOffset())
+	}
+	return out, nil
+}
+
+// marshalCanonical marshals v with marshal, a method of M, then canonicalizes the output.
+// Values within v are marshaled without canonicalizing, since the whole output is canonicalized once.
+func (M March) marshalCanonical(marshal func(March, interface{}) ([]byte, error), v interface{}) (data []byte, err error) {
+	if _, isJSON := M.ActiveCodec().(JSONCodec); !isJSON {
+		return nil, fmt.Errorf("Canonical output requires JSONCodec, not %T", M.ActiveCodec())
+	}
+	M.canonicalizing = true
+	data, err = marshal(M, v)
+	if err != nil && !isPartial(err) {
+		return
+	}
+	cdata, cerr := CanonicalJSON(data)
+	if cerr != nil {
+		return nil, fmt.Errorf("Canonicalizing failed: %s%w", cerr.Error(), cerr)
+	}
+	return cdata, err
+}
+
+// canonicalMember is a member of an object, with its value in canonical form
+type canonicalMember struct {
+	name  string
+	value []byte
+}
+
+// appendCanonical reads the next value from dec and appends its canonical form to out
+func appendCanonical(out []byte, dec *json.Decoder) ([]byte, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '[' {
+			out = append(out, '[')
+			for i := 0; dec.More(); i++ {
+				if i > 0 {
+					out = append(out, ',')
+				}
+				if out, err = appendCanonical(out, dec); err != nil {
+					return nil, err
+				}
+			}
+			if _, err = dec.Token(); err != nil {
+				return nil, err
+			}
+			return append(out, ']'), nil
+		}
+
+		members := []canonicalMember{}
+		seen := map[string]bool{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			name := key.(string)
+			if seen[name] {
+				return nil, fmt.Errorf("Duplicate name %q", name)
+			}
+			seen[name] = true
+			value, err := appendCanonical(nil, dec)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, canonicalMember{name: name, value: value})
+		}
+		if _, err = dec.Token(); err != nil {
+			return nil, err
+		}
+		sort.Slice(members, func(i, j int) bool {
+			return lessUTF16(members[i].name, members[j].name)
+		})
+		out = append(out, '{')
+		for i, m := range members {
+			if i > 0 {
+				out = append(out, ',')
+			}
+			out = appendCanonicalString(out, m.name)
+			out = append(out, ':')
+			out = append(out, m.value...)
+		}
+		return append(out, '}'), nil
+	case string:
+		return appendCanonicalString(out, t), nil
+	case json.Number:
+		f, err := strconv.ParseFloat(string(t), 64)
+		if err != nil {
+			return nil, fmt.Errorf("Number %s can not be canonicalized: %s%w", t, err.Error(), err)
+		}
+		number := appendCanonicalNumber(nil, f)
+		if !exactInteger(string(t), f, number) {
+			return nil, fmt.Errorf("Number %s can not be canonicalized exactly, it would become %s", t, number)
+		}
+		return append(out, number...), nil
+	case bool:
+		return strconv.AppendBool(out, t), nil
+	default: // nil
+		return append(out, "null"...), nil
+	}
+}
+
+// exactInteger indicates whether canonical, the canonical form of the number s (which parsed as f),
+// has the same value as s, if s is an integer. Integers from 2^53 may not be held exactly by a float64.
+// Other numbers are rounded to the nearest float64, as RFC 8785 does.
+func exactInteger(s string, f float64, canonical []byte) bool {
+	if math.Abs(f) < 1<<53 {
+		return true // Every integer below 2^53 is exact, and so parses to a value below it
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || !r.IsInt() {
+		return true
+	}
+	c, ok := new(big.Rat).SetString(string(canonical))
+	return ok && r.Cmp(c) == 0
+}
+
+// checkUnicode returns an error if data is not valid UTF-8, or has an escaped surrogate which is not part of a pair.
+// encoding/json would replace either with U+FFFD, changing the value.
+func checkUnicode(data []byte) error {
+	if !utf8.Valid(data) {
+		return fmt.Errorf("Invalid UTF-8")
+	}
+	inString := false
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '"':
+			inString = !inString
+		case '\\':
+			if !inString {
+				continue
+			}
+			r, next := escapedRune(data, i), escapedRune(data, i+6)
+			switch {
+			case r >= 0xd800 && r < 0xdc00 && next >= 0xdc00 && next < 0xe000:
+				i += 11 // A pair
+			case utf16.IsSurrogate(r):
+				return fmt.Errorf("Lone surrogate %s at offset %d", data[i:i+6], i)
+			default:
+				i++ // The escaped character, which may be a quote
+			}
+		}
+	}
+	return nil
+}
+
+// escapedRune returns the rune of a \uXXXX escape at offset i of data, or -1 if there is none
+func escapedRune(data []byte, i int) rune {
+	if i+6 > len(data) || data[i] != '\\' || data[i+1] != 'u' {
+		return -1
+	}
+	r, err := strconv.ParseUint(string(data[i+2:i+6]), 16, 16)
+	if err != nil {
+		return -1
+	}
+	return rune(r)
+}
+
+// lessUTF16 compares strings by their UTF-16 code units, as RFC 8785 sorts names
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+// appendCanonicalString appends s as a JSON string, escaping only quotes, backslashes and control characters
+func appendCanonicalString(out []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	out = append(out, '"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			out = append(out, `\"`...)
+		case '\\':
+			out = append(out, `\\`...)
+		case '\b':
+			out = append(out, `\b`...)
+		case '\f':
+			out = append(out, `\f`...)
+		case '\n':
+			out = append(out, `\n`...)
+		case '\r':
+			out = append(out, `\r`...)
+		case '\t':
+			out = append(out, `\t`...)
+		default:
+			if r < 0x20 {
+				out = append(out, '\\', 'u', '0', '0', hex[r>>4], hex[r&0xf])
+			} else {
+				out = append(out, string(r)...)
+			}
+		}
+	}
+	return append(out, '"')
+}
+
+// appendCanonicalNumber appends f as ES6 Number.prototype.toString formats it.
+// f must be finite.
+func appendCanonicalNumber(out []byte, f float64) []byte {
+	if f == 0 { // Including -0
+		return append(out, '0')
+	}
+	if f < 0 {
+		out = append(out, '-')
+		f = -f
+	}
+
+	// The shortest digits which round trip, and the position n of the decimal point relative to them
+	e := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, exp := e[:strings.IndexByte(e, 'e')], e[strings.IndexByte(e, 'e')+1:]
+	digits := strings.Replace(mantissa, ".", "", 1)
+	x, _ := strconv.Atoi(exp)
+	n, k := x+1, len(digits)
+
+	switch {
+	case k <= n && n <= 21:
+		out = append(out, digits...)
+		out = append(out, strings.Repeat("0", n-k)...)
+	case 0 < n && n <= 21:
+		out = append(out, digits[:n]...)
+		out = append(out, '.')
+		out = append(out, digits[n:]...)
+	case -6 < n && n <= 0:
+		out = append(out, "0."...)
+		out = append(out, strings.Repeat("0", -n)...)
+		out = append(out, digits...)
+	default:
+		out = append(out, digits[0])
+		if k > 1 {
+			out = append(out, '.')
+			out = append(out, digits[1:]...)
+		}
+		out = append(out, 'e')
+		if n-1 >= 0 {
+			out = append(out, '+')
+		}
+		out = strconv.AppendInt(out, int64(n-1), 10)
+	}
+	return out
+}
@@ -0,0 +1,413 @@
+package march
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// IssueKind categorizes the problems found by March.Check
+type IssueKind string
+
+// Kinds of Issue
+const (
+	IssueDuplicateTag IssueKind = "duplicate tag" // Two fields of a struct share a tag name, or one tag name is a path within the other
+	IssueRemainsType  IssueKind = "remains type"  // A remains field has a type which cannot receive fields
+	IssueHoistType    IssueKind = "hoist type"    // A hoist field has a type which cannot be hoisted
+	IssueLazyType     IssueKind = "lazy type"     // A lazy field has a type which cannot hold raw data
+	IssueMapKey       IssueKind = "map key"       // A map has a key type which is not supported by M.ActiveKeyCodec()
+	IssueSignature    IssueKind = "signature"     // A custom method does not match the signature March expects
+	IssueUnknownFlag  IssueKind = "unknown flag"  // A tag has a flag with no handler
+	IssueUnsupported  IssueKind = "unsupported"   // A type which the default un/marshalers do not support
+)
+
+// Issue is a single problem found by March.Check
+type Issue struct {
+	Path    string       // The location of the problem, such as $.nest.items[].custom
+	Type    reflect.Type // The type at Path
+	Kind    IssueKind
+	Message string
+}
+
+// Error implements error
+func (i Issue) Error() string {
+	return fmt.Sprintf("%s (%s): %s: %s", i.Path, i.Type, i.Kind, i.Message)
+}
+
+// Report is the result of March.Check
+type Report struct {
+	Type   reflect.Type
+	Issues []Issue
+}
+
+// OK indicates whether no issues were found
+func (r Report) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Err returns nil if no issues were found, or an error listing every issue.
+func (r Report) Err() error {
+	if r.OK() {
+		return nil
+	}
+	return fmt.Errorf("March configuration of %s has %d issue(s):\n\t%s", r.Type, len(r.Issues), r.String())
+}
+
+// String lists the issues in the report, one per line
+func (r Report) String() string {
+	lines := []string{}
+	for _, i := range r.Issues {
+		lines = append(lines, i.Error())
+	}
+	return strings.Join(lines, "\n\t")
+}
+
+// Check inspects a type (given as a reflect.Type, reflect.Value or any value of the type)
+// and reports problems with its configuration, which would otherwise only be found
+// (or panic) when values are un/marshaled at runtime.
+// It is intended to be used in init functions and unit tests.
+func (M March) Check(v interface{}) (r Report) {
+	var T reflect.Type
+	switch t := v.(type) {
+	case reflect.Type:
+		T = t
+	case reflect.Value:
+		T = t.Type()
+	default:
+		T = reflect.TypeOf(v)
+	}
+	r.Type = T
+	if T == nil {
+		return
+	}
+	c := checker{M: M, seen: map[reflect.Type]bool{}}
+	c.check("$", T)
+	r.Issues = c.issues
+	return
+}
+
+type checker struct {
+	M      March
+	seen   map[reflect.Type]bool
+	issues []Issue
+}
+
+func (c *checker) issue(path string, t reflect.Type, kind IssueKind, format string, args ...interface{}) {
+	c.issues = append(c.issues, Issue{
+		Path:    path,
+		Type:    t,
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// check inspects t and the types it contains
+func (c *checker) check(path string, t reflect.Type) {
+	if c.seen[t] {
+		return
+	}
+	c.seen[t] = true
+
+	c.checkMethods(path, t)
+	if c.hasCustomMarshalers(t) {
+		return // March does not look inside types which un/marshal themselves
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		c.check(path, t.Elem())
+	case reflect.Slice, reflect.Array:
+		c.check(path+"[]", t.Elem())
+	case reflect.Map:
+		c.checkKey(path, t)
+		c.check(path+"[]", t.Elem())
+	case reflect.Struct:
+		c.checkStruct(path, t)
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		c.issue(path, t, IssueUnsupported, "%s values cannot be un/marshaled", t.Kind())
+	}
+}
+
+// checkedName is the tag name of a field which has been checked, see checkName
+type checkedName struct {
+	tag   string
+	path  []PathStep
+	field string // The Go field name
+}
+
+// checkStruct inspects the tagged fields of a struct
+func (c *checker) checkStruct(path string, t reflect.Type) {
+	names := []checkedName{}
+	c.checkFields(path, t, &names)
+}
+
+// checkFields inspects the tagged fields of a struct, recording their names
+// in names, which is shared with any hoisted structs.
+func (c *checker) checkFields(path string, t reflect.Type, names *[]checkedName) {
+	for _, fp := range c.M.plan(t).fields {
+		fd := fp.descriptor
+		fpath := path + "." + fd.TagName
+
+		for _, flag := range fd.TagFlags {
+			if _, ok := c.M.FlagHandler(flag); !ok && len(flag) > 0 {
+				c.issue(fpath, fd.Type, IssueUnknownFlag, "field %s has flag %q with no handler", fp.name, flag)
+			}
+		}
+		if !fd.FlagsContain(FlagRemain) && !fd.FlagsContain(FlagHoist) { // Their tag names are not written
+			c.checkName(fpath, fp.name, fd, names)
+		}
+
+		switch {
+		case fd.FlagsContain(FlagRemain):
+			if !isRemainsType(fd.Type) {
+				c.issue(fpath, fd.Type, IssueRemainsType, "field %s must be a map of []byte, json.RawMessage or RawUnmarshal", fp.name)
+			} else {
+				c.checkKey(fpath, fd.Type)
+			}
+			continue
+		case fd.FlagsContain(FlagHoist):
+			c.checkHoist(fpath, fp.name, fd.Type, names)
+			continue
+		case fd.FlagsContain(FlagLazy):
+			if !isRawType(fd.Type) {
+				c.issue(fpath, fd.Type, IssueLazyType, "field %s must be Lazy, *Lazy, RawUnmarshal, json.RawMessage or []byte, or unmarshaling it fails", fp.name)
+			}
+			continue
+		}
+		c.check(fpath, fd.Type)
+	}
+}
+
+// checkName reports a field whose tag name is the same as that of a field in names,
+// or which is a path within it (such as `data` and `data.v`), then records it in names.
+func (c *checker) checkName(path, field string, fd FieldDescriptor, names *[]checkedName) {
+	for _, other := range *names {
+		switch {
+		case other.tag == fd.TagName:
+			c.issue(path, fd.Type, IssueDuplicateTag, "fields %s and %s share the tag name %q", other.field, field, fd.TagName)
+			return
+		case isPathPrefix(other.path, fd.TagPath) || isPathPrefix(fd.TagPath, other.path):
+			c.issue(path, fd.Type, IssueDuplicateTag, "fields %s and %s have the tag names %q and %q, one of which is within the other", other.field, field, other.tag, fd.TagName)
+			return
+		}
+	}
+	*names = append(*names, checkedName{tag: fd.TagName, path: fd.TagPath, field: field})
+}
+
+// isPathPrefix indicates whether the path a is the start of the path b
+func isPathPrefix(a, b []PathStep) bool {
+	if len(a) > len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkKey inspects the key type of a map, by converting its zero value to a name and back with M.ActiveKeyCodec()
+func (c *checker) checkKey(path string, t reflect.Type) {
+	codec := c.M.ActiveKeyCodec()
+	name, err := codec.MarshalKey(reflect.Zero(t.Key()))
+	if err == nil {
+		_, err = codec.UnmarshalKey(name, t.Key())
+	}
+	if err != nil {
+		c.issue(path, t, IssueMapKey, "map key type %s is not supported: %s", t.Key(), err.Error())
+	}
+}
+
+// checkHoist inspects the type of a field with the hoist flag
+func (c *checker) checkHoist(path, name string, t reflect.Type, names *[]checkedName) {
+	switch {
+	case t.Kind() == reflect.Struct:
+		c.checkMethods(path, t)
+		c.checkFields(path, t, names)
+	case t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct:
+		c.checkMethods(path, t.Elem())
+		c.checkFields(path, t.Elem(), names)
+	case t.Kind() == reflect.Map:
+		c.checkKey(path, t)
+		c.check(path+"[]", t.Elem())
+	default:
+		c.issue(path, t, IssueHoistType, "field %s must be a struct, *struct or map", name)
+	}
+}
+
+// checkMethods checks the signatures of any custom methods on t or *t
+func (c *checker) checkMethods(path string, t reflect.Type) {
+	for _, s := range c.M.signatures() {
+		for _, mt := range []reflect.Type{t, reflect.PtrTo(t)} {
+			m, ok := mt.MethodByName(s.name)
+			if !ok {
+				continue
+			}
+			if !s.matches(m.Type) {
+				c.issue(path, mt, IssueSignature, "method %s is %s, expected %s", s.name, methodString(m.Type), s)
+			}
+			break
+		}
+	}
+}
+
+// hasCustomMarshalers indicates whether March would call custom methods
+// to both marshal and unmarshal t, rather than looking at its contents.
+func (c *checker) hasCustomMarshalers(t reflect.Type) bool {
+	has := func(name string) bool {
+		_, ok := t.MethodByName(name)
+		_, pok := reflect.PtrTo(t).MethodByName(name)
+		return ok || pok
+	}
+	if has(c.M.MarshalMethodName()) && has(c.M.UnmarshalMethodName()) {
+		return true
+	}
+	return !c.M.NoMarshalJSON && !c.M.NoUnmarshalJSON && c.M.isJSON() && has("MarshalJSON") && has("UnmarshalJSON")
+}
+
+// signature describes the expected inputs and outputs of a custom method, excluding the receiver
+type signature struct {
+	name string
+	in   []reflect.Type
+	out  []reflect.Type
+	or   []signature // Alternative signatures which are also accepted
+}
+
+var (
+	typeBytes         = reflect.TypeOf([]byte{})
+	typeFields        = reflect.TypeOf(map[string][]byte{})
+	typeOrderedFields = reflect.TypeOf(Fields{})
+	typeError         = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// signatures lists the custom methods which March may call, with their expected signatures
+func (M March) signatures() []signature {
+	sigs := []signature{
+		marshalSignature(M.MarshalMethodName()),
+		unmarshalSignature(M.UnmarshalMethodName()),
+		readFieldsSignature(M.ReadFieldsMethodName()),
+		writeFieldsSignature(M.WriteFieldsMethodName()),
+	}
+	if !M.NoMarshalJSON && M.isJSON() {
+		sigs = append(sigs, marshalSignature("MarshalJSON"))
+	}
+	if !M.NoUnmarshalJSON && M.isJSON() {
+		sigs = append(sigs, unmarshalSignature("UnmarshalJSON"))
+	}
+	return sigs
+}
+
+// marshalSignature is the signature of MarshalX: func() ([]byte, error)
+func marshalSignature(name string) signature {
+	return signature{name: name, out: []reflect.Type{typeBytes, typeError}}
+}
+
+// unmarshalSignature is the signature of UnmarshalX: func([]byte) error
+func unmarshalSignature(name string) signature {
+	return signature{name: name, in: []reflect.Type{typeBytes}, out: []reflect.Type{typeError}}
+}
+
+// readFieldsSignature is the signature of ReadFieldsX: func([]byte) (map[string][]byte, error) or func([]byte) (Fields, error)
+func readFieldsSignature(name string) signature {
+	return signature{name: name, in: []reflect.Type{typeBytes}, out: []reflect.Type{typeFields, typeError}, or: []signature{
+		{name: name, in: []reflect.Type{typeBytes}, out: []reflect.Type{typeOrderedFields, typeError}},
+	}}
+}
+
+// writeFieldsSignature is the signature of WriteFieldsX: func(map[string][]byte) ([]byte, error) or func(Fields) ([]byte, error)
+func writeFieldsSignature(name string) signature {
+	return signature{name: name, in: []reflect.Type{typeFields}, out: []reflect.Type{typeBytes, typeError}, or: []signature{
+		{name: name, in: []reflect.Type{typeOrderedFields}, out: []reflect.Type{typeBytes, typeError}},
+	}}
+}
+
+// matches indicates whether the given method type (including its receiver) fits the signature or one of its alternatives.
+// Outputs may be assignable to the expected types, such as json.RawMessage in place of []byte.
+func (s signature) matches(mt reflect.Type) bool {
+	if s.matchesExactly(mt) {
+		return true
+	}
+	for _, alt := range s.or {
+		if alt.matches(mt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s signature) matchesExactly(mt reflect.Type) bool {
+	if mt.NumIn() != len(s.in)+1 || mt.NumOut() != len(s.out) || mt.IsVariadic() {
+		return false
+	}
+	for i, t := range s.in {
+		if !t.AssignableTo(mt.In(i + 1)) {
+			return false
+		}
+	}
+	for i, t := range s.out {
+		if !mt.Out(i).AssignableTo(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the signature like a Go func type
+func (s signature) String() string {
+	alts := []string{formatSignature(s.in, s.out)}
+	for _, alt := range s.or {
+		alts = append(alts, alt.String())
+	}
+	return strings.Join(alts, " or ")
+}
+
+// methodString formats a method type like a Go func type, excluding the receiver
+func methodString(mt reflect.Type) string {
+	in := []reflect.Type{}
+	for i := 1; i < mt.NumIn(); i++ {
+		in = append(in, mt.In(i))
+	}
+	out := []reflect.Type{}
+	for i := 0; i < mt.NumOut(); i++ {
+		out = append(out, mt.Out(i))
+	}
+	return formatSignature(in, out)
+}
+
+func formatSignature(in, out []reflect.Type) string {
+	ins := []string{}
+	for _, t := range in {
+		ins = append(ins, t.String())
+	}
+	outs := []string{}
+	for _, t := range out {
+		outs = append(outs, t.String())
+	}
+	switch len(outs) {
+	case 0:
+		return fmt.Sprintf("func(%s)", strings.Join(ins, ", "))
+	case 1:
+		return fmt.Sprintf("func(%s) %s", strings.Join(ins, ", "), outs[0])
+	}
+	return fmt.Sprintf("func(%s) (%s)", strings.Join(ins, ", "), strings.Join(outs, ", "))
+}
+
+// isRemainsType indicates whether t can receive the fields of a remains flag
+func isRemainsType(t reflect.Type) bool {
+	if t.Kind() != reflect.Map {
+		return false
+	}
+	e := t.Elem()
+	return e == typeBytes || e == reflect.TypeOf(json.RawMessage{}) || e == reflect.TypeOf(RawUnmarshal{})
+}
+
+// isRawType indicates whether t can hold the raw data of a lazy flag
+func isRawType(t reflect.Type) bool {
+	switch t {
+	case reflect.TypeOf(Lazy{}), reflect.TypeOf(&Lazy{}), reflect.TypeOf(RawUnmarshal{}), reflect.TypeOf(json.RawMessage{}), typeBytes:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package march
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Codec is the wire format used by the default un/marshalers (MarshalAsJSON and UnmarshalAsJSON).
+// March walks types, tags and flags, while the Codec only deals with encoded bytes:
+// splitting and joining objects and sequences, and encoding the values March does not walk.
+type Codec interface {
+	// ReadFields splits an encoded object into its named fields.
+	// It is the first stage of unmarshaling a struct.
+	ReadFields(data []byte) (fields map[string][]byte, err error)
+	// WriteFields joins named, encoded fields into an object.
+	// It is the last stage of marshaling a struct.
+	WriteFields(fields map[string][]byte) (data []byte, err error)
+	// ReadSequence splits an encoded sequence into its encoded elements.
+	ReadSequence(data []byte) (elems [][]byte, err error)
+	// WriteSequence joins encoded elements into a sequence.
+	WriteSequence(elems [][]byte) (data []byte, err error)
+	// MarshalScalar encodes a value which March does not walk, such as a primitive or nil.
+	// Input equal to the encoding of nil is null, which resets maps and interfaces, and leaves arrays untouched.
+	MarshalScalar(v interface{}) (data []byte, err error)
+	// UnmarshalScalar decodes data onto v, a pointer to a value which March does not walk.
+	UnmarshalScalar(data []byte, v interface{}) (err error)
+}
+
+// ActiveCodec returns the Codec property on M or a sane default (JSONCodec).
+// It should be used instead of M.Codec directly
+func (M March) ActiveCodec() Codec {
+	if M.Codec != nil {
+		return M.Codec
+	}
+	return JSONCodec{}
+}
+
+// isJSON indicates whether M.ActiveCodec() is JSONCodec, so that MarshalJSON and UnmarshalJSON methods apply
+func (M March) isJSON() bool {
+	_, ok := M.ActiveCodec().(JSONCodec)
+	return ok
+}
+
+// isNull indicates whether data is the encoding of nil in M.ActiveCodec(), such as null in JSON
+func (M March) isNull(data []byte) bool {
+	codec := M.ActiveCodec()
+	if _, ok := codec.(JSONCodec); ok {
+		return bytes.Equal(bytes.TrimSpace(data), []byte("null"))
+	}
+	null, err := codec.MarshalScalar(nil)
+	return err == nil && bytes.Equal(bytes.TrimSpace(data), bytes.TrimSpace(null))
+}
+
+// JSONCodec is the default Codec, based on encoding/json.
+type JSONCodec struct{}
+
+// ReadFields implements Codec via ReadFieldsJSON
+func (JSONCodec) ReadFields(data []byte) (fields map[string][]byte, err error) {
+	return ReadFieldsJSON(data)
+}
+
+// WriteFields implements Codec via WriteFieldsJSON
+func (JSONCodec) WriteFields(fields map[string][]byte) (data []byte, err error) {
+	return WriteFieldsJSON(fields)
+}
+
+// ReadSequence implements Codec via ReadSequenceJSON
+func (JSONCodec) ReadSequence(data []byte) (elems [][]byte, err error) {
+	return ReadSequenceJSON(data)
+}
+
+// WriteSequence implements Codec via WriteSequenceJSON
+func (JSONCodec) WriteSequence(elems [][]byte) (data []byte, err error) {
+	return WriteSequenceJSON(elems)
+}
+
+// MarshalScalar implements Codec via json.Marshal
+func (JSONCodec) MarshalScalar(v interface{}) (data []byte, err error) {
+	return json.Marshal(v)
+}
+
+// UnmarshalScalar implements Codec via json.Unmarshal
+func (JSONCodec) UnmarshalScalar(data []byte, v interface{}) (err error) {
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,304 @@
+package march
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"strings"
+)
+
+// Errors which describe a value by its path from the root of the input or output, such as $.nest.items[3].custom.
+// Each step of the path is a tag name (or map key) after a dot, or a sequence index in brackets.
+
+// UnmarshalTypeError describes input which can not be unmarshaled onto a Go type
+type UnmarshalTypeError struct {
+	Path  string
+	Type  reflect.Type // The Go type of the value
+	Value string       // A description of the input, such as "string", "sequence" or "map key"
+	Err   error        // The cause, if any
+}
+
+// Error implements error
+func (e *UnmarshalTypeError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s", e.Path, e.Err.Error())
+	}
+	return fmt.Sprintf("%s: Cannot unmarshal %s onto %s", e.Path, e.Value, e.Type)
+}
+
+// Unwrap returns the cause of the error
+func (e *UnmarshalTypeError) Unwrap() error {
+	return e.Err
+}
+
+// SyntaxError describes malformed input. The position is of the byte at which the error was found,
+// within the data passed to Unmarshal.
+type SyntaxError struct {
+	Path   string
+	Type   reflect.Type // The Go type of the value
+	Offset int64        // The number of bytes read before the error
+	Line   int          // Starting at 1
+	Column int          // In bytes, starting at 1
+	Err    error
+}
+
+// Error implements error
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s: Syntax error at line %d, column %d: %s", e.Path, e.Line, e.Column, e.Err.Error())
+}
+
+// Unwrap returns the error from the codec, such as a *json.SyntaxError
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// MissingFieldError describes a field with the required flag which is not present in the input
+type MissingFieldError struct {
+	Path string
+	Type reflect.Type // The Go type of the field
+}
+
+// Error implements error
+func (e *MissingFieldError) Error() string {
+	return fmt.Sprintf("%s: Missing required field of type %s", e.Path, e.Type)
+}
+
+// MethodError wraps an error returned by a custom method, such as MarshalX, UnmarshalJSON or ReadFieldsX
+type MethodError struct {
+	Path   string
+	Type   reflect.Type // The receiver of the method
+	Method string
+	Err    error
+}
+
+// Error implements error
+func (e *MethodError) Error() string {
+	return fmt.Sprintf("%s: %s.%s failed: %s", e.Path, e.Type, e.Method, e.Err.Error())
+}
+
+// Unwrap returns the error from the method
+func (e *MethodError) Unwrap() error {
+	return e.Err
+}
+
+// DuplicateFieldError describes a field which has the same name as one already marshaled, or read by a ReadFieldsX method. See March.Duplicates.
+type DuplicateFieldError struct {
+	Path string
+	Name string
+}
+
+// Error implements error
+func (e *DuplicateFieldError) Error() string {
+	return fmt.Sprintf("%s: Duplicate field %q", e.Path, e.Name)
+}
+
+// PanicError is returned when un/marshaling a value panics, unless M.NoRecover is set.
+// Panics always stop un/marshaling, regardless of M.Strict and M.Collect.
+type PanicError struct {
+	Path  string
+	Type  reflect.Type // The Go type of the value, if known
+	Value interface{}  // The value passed to panic
+	Stack []byte       // The stack trace of the panic
+}
+
+// Error implements error
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s: Panic while un/marshaling %v: %v", e.Path, e.Type, e.Value)
+}
+
+// Unwrap returns the value passed to panic, if it is an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// recoverPanic is deferred by the un/marshalers of v, to convert a panic to a *PanicError in err.
+func (M March) recoverPanic(v interface{}, err *error) {
+	if M.NoRecover {
+		return
+	}
+	r := recover()
+	if r == nil {
+		return
+	}
+	perr := &PanicError{Path: "$", Value: r, Stack: debug.Stack()}
+	switch V := v.(type) {
+	case reflect.Value:
+		if V.IsValid() {
+			perr.Type = V.Type()
+		}
+	case *reflect.Value:
+		if V != nil && V.IsValid() {
+			perr.Type = V.Type()
+		}
+	default:
+		perr.Type = reflect.TypeOf(v)
+	}
+	*err = perr
+}
+
+// FieldErrors is returned when M.Collect is set, listing the error of every field which failed
+// (with its path) once the rest of the value has been un/marshaled.
+// Use errors.Is and errors.As to find a particular error among them.
+type FieldErrors struct {
+	Errors []error
+}
+
+// Error implements error
+func (e *FieldErrors) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d field(s) failed:\n\t%s", len(e.Errors), strings.Join(msgs, "\n\t"))
+}
+
+// Is reports whether any of the errors matches target, for errors.Is
+func (e *FieldErrors) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors which matches target, for errors.As
+func (e *FieldErrors) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// add appends err to the list, or the errors it lists
+func (e *FieldErrors) add(err error) {
+	if list, ok := err.(*FieldErrors); ok {
+		e.Errors = append(e.Errors, list.Errors...)
+	} else {
+		e.Errors = append(e.Errors, err)
+	}
+}
+
+// err returns the list as an error, or nil if it is empty
+func (e *FieldErrors) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return &FieldErrors{Errors: e.Errors}
+}
+
+// isPartial indicates whether err is a *FieldErrors, meaning that the value was un/marshaled apart from the listed fields.
+func isPartial(err error) bool {
+	_, ok := err.(*FieldErrors)
+	return ok
+}
+
+// fieldError handles an error from un/marshaling the named field according to M.Verbose, M.Collect and M.Strict.
+// It returns the error only if un/marshaling should stop. If M.Collect is set, the error is added to errs instead.
+func (M March) fieldError(errs *FieldErrors, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*PanicError); ok {
+		return err
+	}
+	if !isPartial(err) { // The errors in a list have already been handled
+		M.logf("Field %s: %s", name, err.Error())
+	}
+	if M.Collect {
+		errs.add(err)
+		return nil
+	}
+	if M.Strict {
+		return err
+	}
+	return nil
+}
+
+// pathError is implemented by errors which carry a path
+type pathError interface {
+	prependPath(step string)
+}
+
+func (e *UnmarshalTypeError) prependPath(step string)  { e.Path = prependPath(e.Path, step) }
+func (e *SyntaxError) prependPath(step string)         { e.Path = prependPath(e.Path, step) }
+func (e *MissingFieldError) prependPath(step string)   { e.Path = prependPath(e.Path, step) }
+func (e *MethodError) prependPath(step string)         { e.Path = prependPath(e.Path, step) }
+func (e *PanicError) prependPath(step string)          { e.Path = prependPath(e.Path, step) }
+func (e *DuplicateFieldError) prependPath(step string) { e.Path = prependPath(e.Path, step) }
+
+func prependPath(path, step string) string {
+	return "$" + step + strings.TrimPrefix(path, "$")
+}
+
+// withPath prepends a step to the path of every error in the chain of err,
+// as it is returned from a nested value to its parent.
+func withPath(err error, step string) error {
+	if list, ok := err.(*FieldErrors); ok {
+		for _, e := range list.Errors {
+			withPath(e, step)
+		}
+		return err
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if p, ok := e.(pathError); ok {
+			p.prependPath(step)
+		}
+	}
+	return err
+}
+
+// fieldStep returns the path step for a field or map key
+func fieldStep(name string) string {
+	return "." + name
+}
+
+// indexStep returns the path step for an element of a sequence
+func indexStep(i int) string {
+	return fmt.Sprintf("[%d]", i)
+}
+
+// decodeError converts an error from the codec, decoding data onto a value of type t, to a typed error where possible.
+func (M March) decodeError(t reflect.Type, data []byte, err error) error {
+	var serr *json.SyntaxError
+	var terr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &serr):
+		root, start := data, 0
+		if offset, ok := M.index.offset(data); ok {
+			root, start = M.index.root, offset
+		}
+		e := &SyntaxError{Path: "$", Type: t, Offset: int64(start) + serr.Offset, Err: err}
+		e.Line, e.Column = position(root, int(e.Offset))
+		return e
+	case errors.As(err, &terr):
+		return &UnmarshalTypeError{Path: "$", Type: t, Value: terr.Value, Err: err}
+	}
+	return err
+}
+
+// position returns the line and column of the byte before offset in data
+func position(data []byte, offset int) (line, column int) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	line, column = 1, 1
+	for _, c := range data[:offset] {
+		if c == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
+	}
+	if column > 1 {
+		column-- // The byte which was read last
+	}
+	return
+}
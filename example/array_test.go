@@ -0,0 +1,66 @@
+package example
+
+import (
+	"testing"
+
+	march "github.com/CreativeCactus/March"
+)
+
+type Vector struct {
+	Hash   [4]byte    `March:"hash"`
+	Coords [3]float64 `March:"coords"`
+	Temps  [2]Temp    `March:"temps"`
+}
+
+func TestUnmarshalArray(t *testing.T) {
+	M := march.March{Tag: "March", Strict: true}
+	v := Vector{Hash: [4]byte{1, 2, 3, 4}, Coords: [3]float64{1.5, -2, 0}, Temps: [2]Temp{20, 21.5}}
+
+	data, err := M.Marshal(v)
+	if err != nil {
+		t.Fatalf("March Marshal Error: %s", err.Error())
+	}
+	if want := `{"hash":[1,2,3,4],"coords":[1.5,-2,0],"temps":["20C","21.5C"]}`; string(data) != want {
+		t.Fatalf("Got %s, expected %s", string(data), want)
+	}
+	back := Vector{}
+	if err := M.Unmarshal(data, &back); err != nil {
+		t.Fatalf("March Unmarshal Error: %s", err.Error())
+	}
+	if back != v {
+		t.Fatalf("Got %+v, expected %+v", back, v)
+	}
+
+	for _, test := range []struct {
+		policy march.ArrayPolicy
+		data   string
+		want   [3]int
+		fails  bool
+	}{
+		{0, `[1,2,3]`, [3]int{1, 2, 3}, false},
+		{0, `[1,2]`, [3]int{}, true},
+		{0, `[1,2,3,4]`, [3]int{}, true},
+		{march.ArrayTruncate, `[1,2,3,4]`, [3]int{1, 2, 3}, false},
+		{march.ArrayTruncate, `[1,2]`, [3]int{}, true},
+		{march.ArrayZeroFill, `[1,2]`, [3]int{1, 2, 0}, false},
+		{march.ArrayZeroFill, `[1,2,3,4]`, [3]int{}, true},
+		{march.ArrayTruncate | march.ArrayZeroFill, `[1]`, [3]int{1, 0, 0}, false},
+		{march.ArrayTruncate | march.ArrayZeroFill, `[1,2,3,4]`, [3]int{1, 2, 3}, false},
+	} {
+		M := march.March{Tag: "March", Arrays: test.policy}
+		got := [3]int{9, 9, 9}
+		err := M.Unmarshal([]byte(test.data), &got)
+		if test.fails {
+			if err == nil {
+				t.Fatalf("Expected an error for %s with policy %d", test.data, test.policy)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if got != test.want {
+			t.Fatalf("Got %v, expected %v for %s with policy %d", got, test.want, test.data, test.policy)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package example
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	march "github.com/CreativeCactus/March"
+)
+
+// Spaced marshals itself with whitespace, unsorted names and a long number
+type Spaced struct{}
+
+func (Spaced) MarshalMarch() ([]byte, error) {
+	return []byte(`{ "z": 1.50, "a": [ 1e21, 0.0000001 ] }`), nil
+}
+
+// Escaped is marshaled by its MarshalJSON method, which escapes HTML as json.Marshal does
+type Escaped string
+
+func (e Escaped) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"v": string(e), "b": "é"})
+}
+
+// Payload is signed, so it is marshaled canonically
+type Payload struct {
+	Name    string              `March:"name"`
+	Amount  float64             `March:"amount"`
+	Spaced  Spaced              `March:"spaced"`
+	Escaped Escaped             `March:"escaped"`
+	Any     interface{}         `March:"any"`
+	Extra   map[string][]byte   `March:"_,remains"`
+	Nested  map[string]*Payload `March:"nested"`
+}
+
+func TestCanonical(t *testing.T) {
+	M := march.March{Tag: "March", Canonical: true}
+	v := Payload{
+		Name:    "<a & b>",
+		Amount:  100,
+		Escaped: "< >",
+		Any:     map[string]interface{}{"y": 2.5e-7, "x": []int{3}},
+		Extra:   map[string][]byte{"€": []byte(` { "k" : 1e2 } `), "\U0001F600": []byte(`true`)},
+		Nested:  map[string]*Payload{"n": {Name: "\t"}},
+	}
+	want := `{` +
+		`"amount":100,` +
+		`"any":{"x":[3],"y":2.5e-7},` +
+		`"escaped":{"b":"é","v":"<` + " " + `>"},` +
+		`"name":"<a & b>",` +
+		`"nested":{"n":{"amount":0,"any":null,"escaped":{"b":"é","v":""},"name":"\t","nested":null,"spaced":{"a":[1e+21,1e-7],"z":1.5}}},` +
+		`"spaced":{"a":[1e+21,1e-7],"z":1.5},` +
+		`"€":{"k":100},` +
+		`"` + "\U0001F600" + `":true}`
+
+	data, err := M.Marshal(v)
+	if err != nil {
+		t.Fatalf("March Marshal Error: %s", err.Error())
+	} else if string(data) != want {
+		t.Fatalf("Value mismatch:\nGot  %s\nWant %s", string(data), want)
+	}
+
+	{ // MarshalAsJSON and Encoder give the same output
+		if data, err = M.MarshalAsJSON(v); err != nil {
+			t.Fatalf("March MarshalAsJSON Error: %s", err.Error())
+		} else if string(data) != want {
+			t.Fatalf("Value mismatch:\nGot  %s\nWant %s", string(data), want)
+		}
+		buf := &bytes.Buffer{}
+		if err = M.NewEncoder(buf).Encode(v); err != nil {
+			t.Fatalf("March Encode Error: %s", err.Error())
+		} else if buf.String() != want+"\n" {
+			t.Fatalf("Value mismatch:\nGot  %s\nWant %s", buf.String(), want)
+		}
+	}
+
+	{ // Output which is not canonical JSON is an error
+		_, err = M.Marshal(map[string]json.RawMessage{"a": json.RawMessage(`{"b":1,"b":2}`)})
+		if err == nil {
+			t.Fatalf("Expected an error for a duplicate name")
+		}
+		t.Logf("March returned: %s", err.Error())
+
+		for _, bad := range []interface{}{
+			map[string]int64{"id": 9007199254740993},                     // Beyond the integers float64 holds exactly
+			map[string]json.RawMessage{"s": json.RawMessage(`"\ud800"`)}, // A lone surrogate
+		} {
+			if data, err = M.Marshal(bad); err == nil {
+				t.Fatalf("Expected an error for %v, got %s", bad, string(data))
+			}
+			t.Logf("March returned: %s", err.Error())
+		}
+
+		M := march.March{Tag: "March", Canonical: true, Codec: LineCodec{}}
+		if _, err = M.Marshal(v); err == nil {
+			t.Fatalf("Expected an error for a codec other than JSONCodec")
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package example
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	march "github.com/CreativeCactus/March"
+)
+
+type BadSignature struct{}
+
+// MarshalMarch returns too few values
+func (BadSignature) MarshalMarch() []byte { return nil }
+
+type BadConfig struct {
+	Remains map[string]int     `March:"_,remains"`
+	Hoist   int                `March:"_,hoist"`
+	Keys    map[*int]string    `March:"keys"`
+	Lazy    int                `March:"lazy,lazy"`
+	Method  []BadSignature     `March:"method"`
+	Unknown string             `March:"unknown,nonsense"`
+	A       string             `March:"dup"`
+	Hoisted Nested             `March:"_,hoist"`
+	B       string             `March:"nest"`
+	Raw     json.RawMessage    `March:"raw"`
+	Good    map[string][]byte  `March:"_,remains"`
+	Deeper  map[string]*Nested `March:"deeper"`
+}
+
+// Overlapping has tag names which collide in ways that flags and dot notation hide
+type Overlapping struct {
+	A    json.RawMessage `March:"a,lazy"`
+	B    int             `March:"a"`
+	Data int             `March:"data"`
+	V    int             `March:"data.v"`
+	W    int             `March:"list[0]"`
+	X    int             `March:"list[0].x"`
+}
+
+func TestCheck(t *testing.T) {
+	M := march.March{Tag: "March"}
+
+	{ // Well configured types
+		for _, v := range []interface{}{Composite{}, &Flags{}, reflect.TypeOf(Envelope{}), reflect.ValueOf([]Custom{}), MultiHoist{}} {
+			if r := M.Check(v); !r.OK() {
+				t.Fatalf("Unexpected issues: %s", r.Err().Error())
+			}
+		}
+	}
+
+	{ // The duplicate tag in T
+		r := M.Check(T{})
+		if got := len(r.Issues); got != 1 {
+			t.Fatalf("Expected 1 issue, got %d: %s", got, r.String())
+		}
+		if i := r.Issues[0]; i.Kind != march.IssueDuplicateTag || i.Path != "$.s" {
+			t.Fatalf("Unexpected issue: %s", i.Error())
+		}
+	}
+
+	{ // A type with one of each issue
+		r := M.Check(&BadConfig{})
+		want := map[string]march.IssueKind{
+			"$._":        march.IssueHoistType,
+			"$.keys":     march.IssueMapKey,
+			"$.lazy":     march.IssueLazyType,
+			"$.method[]": march.IssueSignature,
+			"$.unknown":  march.IssueUnknownFlag,
+			"$.nest":     march.IssueDuplicateTag,
+		}
+		got := map[string]march.IssueKind{}
+		for _, i := range r.Issues {
+			got[i.Path] = i.Kind
+			if i.Kind == march.IssueRemainsType {
+				continue // Shares a path with the hoist issue
+			}
+			if want[i.Path] != i.Kind {
+				t.Fatalf("Unexpected issue: %s", i.Error())
+			}
+		}
+		for path, kind := range want {
+			if got[path] != kind {
+				t.Fatalf("Missing %s issue at %s in:\n\t%s", kind, path, r.String())
+			}
+		}
+		if got := len(r.Issues); got != 7 {
+			t.Fatalf("Expected 7 issues, got %d:\n\t%s", got, r.String())
+		}
+		t.Logf("Check found issues as expected:\n\t%s", r.String())
+	}
+
+	{ // Duplicates among flagged fields, and names within other names
+		r := M.Check(Overlapping{})
+		want := []string{"$.a", "$.data.v", "$.list[0].x"}
+		if got := len(r.Issues); got != len(want) {
+			t.Fatalf("Expected %d issues, got %d:\n\t%s", len(want), got, r.String())
+		}
+		for n, i := range r.Issues {
+			if i.Kind != march.IssueDuplicateTag || i.Path != want[n] {
+				t.Fatalf("Unexpected issue: %s", i.Error())
+			}
+		}
+	}
+}
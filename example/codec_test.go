@@ -0,0 +1,180 @@
+package example
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	march "github.com/CreativeCactus/March"
+)
+
+// LineCodec is a toy wire format which writes one `key=value` pair per line,
+// with sequences separated by `|` and scalars formatted by fmt.
+// It is only deep enough to demonstrate a flat struct.
+type LineCodec struct{}
+
+func (LineCodec) ReadFields(data []byte) (fields map[string][]byte, err error) {
+	fields = map[string][]byte{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		kv := bytes.SplitN(line, []byte("="), 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Malformed line %q", line)
+		}
+		fields[string(kv[0])] = kv[1]
+	}
+	return
+}
+
+func (LineCodec) WriteFields(fields map[string][]byte) (data []byte, err error) {
+	keys := []string{}
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		data = append(data, []byte(k+"=")...)
+		data = append(data, fields[k]...)
+		data = append(data, '\n')
+	}
+	return
+}
+
+func (LineCodec) ReadSequence(data []byte) (elems [][]byte, err error) {
+	if len(data) == 0 {
+		return [][]byte{}, nil
+	}
+	return bytes.Split(data, []byte("|")), nil
+}
+
+func (LineCodec) WriteSequence(elems [][]byte) (data []byte, err error) {
+	return bytes.Join(elems, []byte("|")), nil
+}
+
+func (LineCodec) MarshalScalar(v interface{}) (data []byte, err error) {
+	if v == nil {
+		return []byte{}, nil
+	}
+	return []byte(fmt.Sprintf("%v", v)), nil
+}
+
+func (LineCodec) UnmarshalScalar(data []byte, v interface{}) (err error) {
+	switch p := v.(type) {
+	case *string:
+		*p = string(data)
+	case *int:
+		*p, err = strconv.Atoi(string(data))
+	default:
+		err = fmt.Errorf("LineCodec does not support %T", v)
+	}
+	return
+}
+
+type Lines struct {
+	Name string   `March:"name"`
+	Age  int      `March:"age"`
+	Tags []string `March:"tags"`
+}
+
+func TestCodec(t *testing.T) {
+	M := march.March{Tag: "March", Codec: LineCodec{}, Strict: true}
+	v := Lines{Name: "cactus", Age: 3, Tags: []string{"green", "spiky"}}
+
+	data, err := M.Marshal(v)
+	if err != nil {
+		t.Fatalf("March Marshal Error: %s", err.Error())
+	}
+	if want := "age=3\nname=cactus\ntags=green|spiky\n"; string(data) != want {
+		t.Fatalf("Value mismatch: Got %q, Want %q", string(data), want)
+	}
+
+	got := Lines{}
+	if err := M.Unmarshal(data, &got); err != nil {
+		t.Fatalf("March Unmarshal Error: %s", err.Error())
+	}
+	if fmt.Sprintf("%#v", got) != fmt.Sprintf("%#v", v) {
+		t.Fatalf("Value mismatch: Got %#v, Want %#v", got, v)
+	}
+	t.Logf("March round trip via LineCodec: %q\n", data)
+}
+
+type LineArray struct {
+	A [2]string `March:"a"`
+}
+
+func TestCodecNull(t *testing.T) {
+	M := march.March{Tag: "March", Codec: LineCodec{}, Strict: true}
+
+	// The encoding of nil by LineCodec is empty, which is null, rather than a sequence which is too short
+	v := LineArray{}
+	if err := M.Unmarshal([]byte("a=\n"), &v); err != nil {
+		t.Fatalf("March Unmarshal Error: %s", err.Error())
+	}
+
+	// null is not special to LineCodec, so it is a sequence of one element
+	err := M.Unmarshal([]byte("a=null\n"), &v)
+	if err == nil {
+		t.Fatalf("Expected an error for a sequence which is too short")
+	}
+	t.Logf("March returned: %s", err.Error())
+}
+
+// JSONOnly has JSON methods, which must not be used with another Codec
+type JSONOnly struct {
+	Name string `March:"name"`
+}
+
+func (JSONOnly) MarshalJSON() ([]byte, error) {
+	return []byte(`{"json":true}`), nil
+}
+
+func (*JSONOnly) UnmarshalJSON(data []byte) error {
+	return fmt.Errorf("UnmarshalJSON called with %q", data)
+}
+
+func TestCodecJSONMethods(t *testing.T) {
+	v := JSONOnly{Name: "cactus"}
+	data, err := march.March{Tag: "March"}.Marshal(v)
+	if err != nil {
+		t.Fatalf("March Marshal Error: %s", err.Error())
+	}
+	if want := `{"json":true}`; string(data) != want {
+		t.Fatalf("Value mismatch: Got %q, Want %q", string(data), want)
+	}
+
+	// With any other Codec, the JSON methods are not tried
+	M := march.March{Tag: "March", Codec: LineCodec{}, Strict: true}
+	data, err = M.Marshal(v)
+	if err != nil {
+		t.Fatalf("March Marshal Error: %s", err.Error())
+	}
+	if want := "name=cactus\n"; string(data) != want {
+		t.Fatalf("Value mismatch: Got %q, Want %q", string(data), want)
+	}
+	got := JSONOnly{}
+	if err := M.Unmarshal(data, &got); err != nil {
+		t.Fatalf("March Unmarshal Error: %s", err.Error())
+	}
+	if got != v {
+		t.Fatalf("Value mismatch: Got %#v, Want %#v", got, v)
+	}
+	if err := M.Check(JSONOnly{}).Err(); err != nil {
+		t.Fatalf("March Check Error: %s", err.Error())
+	}
+}
+
+func TestCodecDecoder(t *testing.T) {
+	M := march.March{Tag: "March", Codec: LineCodec{}}
+	dec := M.NewDecoder(bytes.NewReader([]byte("age=3\nname=cactus\n")))
+	v := Lines{}
+	err := dec.Decode(&v)
+	if err == nil || !strings.Contains(err.Error(), "JSONCodec") {
+		t.Fatalf("Expected an error from a Decoder without JSONCodec, got %v and %#v", err, v)
+	}
+	t.Logf("March returned: %s", err.Error())
+}
@@ -2,9 +2,13 @@ package example
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
+	"testing"
 
 	march "github.com/CreativeCactus/March"
 )
@@ -139,3 +143,170 @@ func ExampleCustomMarch() {
 	// March    Marshaled data: "aaaa[#0aaaaaaaa[#0aa[]#1aa[]]]"
 	// March Re-Marshaled data: "aaaa[#0aaaaaaaa[#0aa[]#1aa[]]]"
 }
+
+// BadUnmarshal has an UnmarshalMarch and ReadFieldsMarch with the wrong signatures
+type BadUnmarshal struct {
+	V int `March:"v"`
+}
+
+func (*BadUnmarshal) UnmarshalMarch(data []byte, extra int) error { return nil }
+
+func (BadUnmarshal) ReadFieldsMarch(data []byte) map[string][]byte { return nil }
+
+// UpperWriter writes its fields with upper case names
+type UpperWriter struct {
+	V int `March:"v"`
+}
+
+func (UpperWriter) WriteFieldsMarch(fields map[string][]byte) (json.RawMessage, error) {
+	upper := map[string]json.RawMessage{}
+	for k, v := range fields {
+		upper[strings.ToUpper(k)] = v
+	}
+	return json.Marshal(upper)
+}
+
+// CodeError is an error which is not a pointer
+type CodeError struct {
+	Code int
+}
+
+func (e CodeError) Error() string { return fmt.Sprintf("code %d", e.Code) }
+
+// CodeMarshal returns a CodeError from MarshalMarch
+type CodeMarshal struct{}
+
+func (CodeMarshal) MarshalMarch() ([]byte, CodeError) { return nil, CodeError{Code: 7} }
+
+// StringMarshal returns a string, which is convertible to, but not assignable to []byte
+type StringMarshal struct {
+	V int `March:"v"`
+}
+
+func (StringMarshal) MarshalMarch() (string, error) { return `"s"`, nil }
+
+func TestSignatures(t *testing.T) {
+	{ // Mismatched methods are ignored by default
+		M := march.March{Tag: "March"}
+		data, err := M.Marshal(BadSignature{})
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		} else if want := `{}`; string(data) != want {
+			t.Fatalf("Value mismatch: Got %s, Want %s", string(data), want)
+		}
+		v := BadUnmarshal{}
+		if err := M.Unmarshal([]byte(`{"v":1}`), &v); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		} else if want := 1; v.V != want {
+			t.Fatalf("Value mismatch: Got %d, Want %d", v.V, want)
+		}
+	}
+	{ // Or return a SignatureError
+		M := march.March{Tag: "March", StrictSignatures: true}
+		_, err := M.Marshal(BadSignature{})
+		sigErr := &march.SignatureError{}
+		if !errors.As(err, &sigErr) {
+			t.Fatalf("Expected a SignatureError, got %v", err)
+		}
+		if want := "MarshalMarch"; sigErr.Method != want {
+			t.Fatalf("Value mismatch: Got %s, Want %s", sigErr.Method, want)
+		}
+		t.Logf("March returned: %s", err.Error())
+
+		v := BadUnmarshal{}
+		err = M.Unmarshal([]byte(`{"v":1}`), &v)
+		if !errors.As(err, &sigErr) {
+			t.Fatalf("Expected a SignatureError, got %v", err)
+		}
+		t.Logf("March returned: %s", err.Error())
+	}
+	{ // Results which are assignable to the expected types are accepted
+		M := march.March{Tag: "March", StrictSignatures: true}
+		data, err := M.Marshal(UpperWriter{V: 2})
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		} else if want := `{"V":2}`; string(data) != want {
+			t.Fatalf("Value mismatch: Got %s, Want %s", string(data), want)
+		}
+
+		_, err = M.Marshal(CodeMarshal{})
+		codeErr := CodeError{}
+		if !errors.As(err, &codeErr) || codeErr.Code != 7 {
+			t.Fatalf("Expected a CodeError, got %v", err)
+		}
+	}
+	{ // But results which are only convertible are not
+		data, err := march.March{Tag: "March"}.Marshal(StringMarshal{V: 3})
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		} else if want := `{"v":3}`; string(data) != want {
+			t.Fatalf("Value mismatch: Got %s, Want %s", string(data), want)
+		}
+		_, err = march.March{Tag: "March", StrictSignatures: true}.Marshal(StringMarshal{})
+		sigErr := &march.SignatureError{}
+		if !errors.As(err, &sigErr) {
+			t.Fatalf("Expected a SignatureError, got %v", err)
+		}
+	}
+}
+
+// Checked has an UnmarshalMarch method with a value receiver, which accepts only 1
+type Checked int
+
+func (Checked) UnmarshalMarch(data []byte) error {
+	if string(data) != "1" {
+		return errors.New("not 1")
+	}
+	return nil
+}
+
+// Prefixed has UnmarshalMarch and UnmarshalJSON methods with pointer receivers, which prefix the data they were given
+type Prefixed string
+
+func (p *Prefixed) UnmarshalMarch(data []byte) error {
+	*p = Prefixed("march:" + string(data))
+	return nil
+}
+
+func (p *Prefixed) UnmarshalJSON(data []byte) error {
+	*p = Prefixed("json:" + string(data))
+	return nil
+}
+
+type Receivers struct {
+	Checked   Checked             `March:"checked"`
+	CheckedP  *Checked            `March:"checkedp"`
+	Prefixed  Prefixed            `March:"prefixed"`
+	PrefixedP *Prefixed           `March:"prefixedp"`
+	List      []Prefixed          `March:"list"`
+	Array     [1]Prefixed         `March:"array"`
+	Map       map[string]Prefixed `March:"map"`
+}
+
+func TestUnmarshalReceivers(t *testing.T) {
+	M := march.March{Tag: "March", Strict: true}
+
+	{ // UnmarshalMarch is found with either receiver, at any level, before UnmarshalJSON
+		data := `{"checked":1,"checkedp":1,"prefixed":"a","prefixedp":"b","list":["c"],"array":["d"],"map":{"e":"f"}}`
+		v := Receivers{}
+		if err := M.Unmarshal([]byte(data), &v); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if v.Prefixed != `march:"a"` || v.PrefixedP == nil || *v.PrefixedP != `march:"b"` ||
+			v.List[0] != `march:"c"` || v.Array[0] != `march:"d"` || v.Map["e"] != `march:"f"` {
+			t.Fatalf("Expected every Prefixed to be unmarshaled by UnmarshalMarch, got %#v", v)
+		}
+		if v.CheckedP == nil {
+			t.Fatalf("Expected checkedp to be allocated")
+		}
+	}
+
+	for _, name := range []string{"checked", "checkedp"} { // A method with a value receiver is called on fields and pointer fields
+		data := fmt.Sprintf(`{%q:2}`, name)
+		err := M.Unmarshal([]byte(data), &Receivers{})
+		var merr *march.MethodError
+		if !errors.As(err, &merr) || merr.Path != "$."+name || merr.Method != "UnmarshalMarch" {
+			t.Fatalf("Expected a MethodError at $.%s, got %v", name, err)
+		}
+	}
+}
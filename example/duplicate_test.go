@@ -0,0 +1,89 @@
+package example
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	march "github.com/CreativeCactus/March"
+)
+
+type Dup struct {
+	A     int                        `March:"x"`
+	H     DupU                       `March:"_,hoist"`
+	B     int                        `March:"x"`
+	Rest  map[string]json.RawMessage `March:"_,remains"`
+	Quote string                     `March:"q\"t"`
+}
+
+type DupU struct {
+	Y int `March:"y"`
+}
+
+func TestDuplicates(t *testing.T) {
+	v := Dup{A: 1, H: DupU{Y: 2}, B: 3, Rest: map[string]json.RawMessage{"y": []byte("4"), "z": []byte("5")}, Quote: `"`}
+	for _, test := range []struct {
+		policy march.DuplicatePolicy
+		want   string
+	}{
+		{march.DuplicateLast, `{"x":3,"y":2,"q\"t":"\"","z":5}`},
+		{march.DuplicateFirst, `{"x":1,"y":2,"q\"t":"\"","z":5}`},
+	} {
+		M := march.March{Tag: "March", Duplicates: test.policy}
+		data, err := M.Marshal(v)
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		if string(data) != test.want {
+			t.Fatalf("Got %s, expected %s", string(data), test.want)
+		}
+		if !json.Valid(data) {
+			t.Fatalf("Invalid JSON %s", string(data))
+		}
+	}
+
+	{ // Each duplicate is a field error
+		M := march.March{Tag: "March", Duplicates: march.DuplicateError, Collect: true}
+		_, err := M.Marshal(map[string]Dup{"d": v})
+		list := &march.FieldErrors{}
+		if !errors.As(err, &list) || len(list.Errors) != 1 {
+			t.Fatalf("Got %v, expected 1 error", err)
+		}
+		paths := []string{}
+		for _, err := range list.Errors {
+			derr := &march.DuplicateFieldError{}
+			if !errors.As(err, &derr) {
+				t.Fatalf("Got %v, expected a DuplicateFieldError", err)
+			}
+			paths = append(paths, derr.Path)
+		}
+		if got, want := strings.Join(paths, " "), "$.d.x"; got != want {
+			t.Fatalf("Got errors at %s, expected %s", got, want)
+		}
+	}
+
+	{ // Tagged and hoisted fields replace remains entries under every policy
+		v := Dup{A: 1, H: DupU{Y: 2}, B: 3, Rest: map[string]json.RawMessage{"x": []byte(`"stale"`), "y": []byte(`"stale"`)}}
+		for _, policy := range []march.DuplicatePolicy{march.DuplicateLast, march.DuplicateFirst, march.DuplicateError} {
+			M := march.March{Tag: "March", Duplicates: policy}
+			data, err := M.Marshal(v)
+			if err != nil {
+				t.Fatalf("March Marshal Error: %s", err.Error())
+			}
+			if strings.Contains(string(data), "stale") || !strings.Contains(string(data), `"y":2`) {
+				t.Fatalf("Got %s with policy %d, expected no remains entries", string(data), policy)
+			}
+		}
+	}
+
+	{ // Escaped keys are streamed too
+		buf := &strings.Builder{}
+		if err := march.NewEncoder(buf).Encode(map[string]int{`a"\b`: 1}); err != nil {
+			t.Fatalf("Encode Error: %s", err.Error())
+		}
+		if got, want := buf.String(), "{\"a\\\"\\\\b\":1}\n"; got != want {
+			t.Fatalf("Got %q, expected %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package example
+
+import (
+	"testing"
+
+	march "github.com/CreativeCactus/March"
+)
+
+type Base struct {
+	ID   int    `March:"id"`
+	Name string `March:"name"`
+}
+
+type Extra struct {
+	Name  string `March:"name"`
+	Note  string `March:"note"`
+	Label string `March:"label"`
+}
+
+type Other struct {
+	Label string `March:"label"`
+}
+
+type Item struct {
+	Base
+	*Extra
+	Other
+	Size int  `March:"size"`
+	Meta Base `March:"meta"`
+}
+
+type WithBase struct {
+	Base Base `March:"_,hoist"`
+}
+
+type WithOther struct {
+	Other *Other `March:"_,hoist"`
+}
+
+// Hoisting embeds two structs which each hoist a field named _
+type Hoisting struct {
+	WithBase
+	WithOther
+	Size int `March:"size"`
+}
+
+type Tagged struct {
+	Base `March:"base"`
+	Size int `March:"size"`
+}
+
+func TestEmbedded(t *testing.T) {
+	M := march.March{Tag: "March", Strict: true}
+
+	{ // Promoted fields, where name ties at the same depth are dropped, and nil pointers are skipped
+		v := Item{Base: Base{ID: 1, Name: "a"}, Other: Other{Label: "l"}, Size: 2}
+		data, err := M.Marshal(v)
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		want := `{"id":1,"size":2,"meta":{"id":0,"name":""}}`
+		if match, err := CompareJSON(data, []byte(want)); err != nil {
+			t.Fatalf("Failed to compare marshaled JSON: %s", err.Error())
+		} else if !match {
+			t.Fatalf("Got %s, expected %s", string(data), want)
+		}
+
+		v.Extra = &Extra{Note: "n"}
+		if data, err = M.Marshal(v); err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		want = `{"id":1,"note":"n","size":2,"meta":{"id":0,"name":""}}`
+		if match, err := CompareJSON(data, []byte(want)); err != nil {
+			t.Fatalf("Failed to compare marshaled JSON: %s", err.Error())
+		} else if !match {
+			t.Fatalf("Got %s, expected %s", string(data), want)
+		}
+	}
+
+	{ // Pointer embeds are allocated only when their fields are present
+		v := Item{}
+		if err := M.Unmarshal([]byte(`{"id":3,"name":"x","size":4}`), &v); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if v.ID != 3 || v.Size != 4 || v.Extra != nil || v.Base.Name != "" {
+			t.Fatalf("Unexpected value %+v", v)
+		}
+		if err := M.Unmarshal([]byte(`{"note":"n"}`), &v); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if v.Extra == nil || v.Note != "n" || v.ID != 0 { // The rest of v is replaced
+			t.Fatalf("Unexpected value %+v", v)
+		}
+	}
+
+	{ // A tagged embed is nested
+		v := Tagged{Base: Base{ID: 5}, Size: 6}
+		data, err := M.Marshal(v)
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		want := `{"base":{"id":5,"name":""},"size":6}`
+		if match, err := CompareJSON(data, []byte(want)); err != nil {
+			t.Fatalf("Failed to compare marshaled JSON: %s", err.Error())
+		} else if !match {
+			t.Fatalf("Got %s, expected %s", string(data), want)
+		}
+		back := Tagged{}
+		if err := M.Unmarshal(data, &back); err != nil || back != v {
+			t.Fatalf("Got %+v, expected %+v (%v)", back, v, err)
+		}
+	}
+	{ // Hoisted fields of embeds do not cancel each other, though they share the name _
+		v := Hoisting{WithBase: WithBase{Base: Base{ID: 1, Name: "a"}}, WithOther: WithOther{Other: &Other{Label: "l"}}, Size: 2}
+		if r := M.Check(v); !r.OK() {
+			t.Fatalf("Unexpected issues: %s", r.String())
+		}
+		data, err := M.Marshal(v)
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		want := `{"id":1,"name":"a","label":"l","size":2}`
+		if match, err := CompareJSON(data, []byte(want)); err != nil {
+			t.Fatalf("Failed to compare marshaled JSON: %s", err.Error())
+		} else if !match {
+			t.Fatalf("Got %s, expected %s", string(data), want)
+		}
+		back := Hoisting{}
+		if err := M.Unmarshal(data, &back); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if back.Base != v.Base || back.Other == nil || *back.Other != *v.Other || back.Size != v.Size {
+			t.Fatalf("Got %+v, expected %+v", back, v)
+		}
+	}
+}
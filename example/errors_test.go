@@ -0,0 +1,166 @@
+package example
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	march "github.com/CreativeCactus/March"
+)
+
+type Order struct {
+	ID    int             `March:"id,required"`
+	Items []Item          `March:"items"`
+	Temps map[string]Temp `March:"temps"`
+	Pair  [2]int          `March:"pair"`
+}
+
+func TestErrors(t *testing.T) {
+	M := march.March{Tag: "March", Strict: true}
+
+	{ // Type errors
+		for _, test := range []struct {
+			data string
+			path string
+			typ  interface{}
+		}{
+			{`{"id":1,"items":[{},{"meta":{"id":"x"}}]}`, "$.items[1].meta.id", 0},
+			{`{"id":1,"pair":[1]}`, "$.pair", [2]int{}},
+			{`{"id":1,"items":{}}`, "$.items", []Item{}},
+		} {
+			err := M.Unmarshal([]byte(test.data), &Order{})
+			terr := &march.UnmarshalTypeError{}
+			if !errors.As(err, &terr) {
+				t.Fatalf("Got %v, expected an UnmarshalTypeError", err)
+			}
+			if terr.Path != test.path || terr.Type != reflect.TypeOf(test.typ) {
+				t.Fatalf("Got %s (%s), expected %s (%T)", terr.Path, terr.Type, test.path, test.typ)
+			}
+		}
+	}
+
+	{ // Syntax errors are positioned in the input
+		err := M.Unmarshal([]byte("{\n  \"id\": 1,\n  \"items\": [}\n}"), &Order{})
+		serr := &march.SyntaxError{}
+		if !errors.As(err, &serr) {
+			t.Fatalf("Got %v, expected a SyntaxError", err)
+		}
+		if serr.Line != 3 || serr.Column != 13 || serr.Offset != 26 {
+			t.Fatalf("Got line %d, column %d, offset %d", serr.Line, serr.Column, serr.Offset)
+		}
+	}
+
+	{ // Missing fields
+		err := M.Unmarshal([]byte(`{"items":[]}`), &Order{})
+		merr := &march.MissingFieldError{}
+		if !errors.As(err, &merr) || merr.Path != "$.id" || merr.Type != reflect.TypeOf(0) {
+			t.Fatalf("Got %v, expected a MissingFieldError", err)
+		}
+		if err := (march.March{Tag: "March"}).Unmarshal([]byte(`{}`), &Order{}); err != nil {
+			t.Fatalf("Unexpected error when not Strict: %s", err.Error())
+		}
+	}
+
+	{ // Errors from custom methods, which can also be found by their cause
+		err := M.Unmarshal([]byte(`{"id":1,"temps":{"a":"warm"}}`), &Order{})
+		merr := &march.MethodError{}
+		if !errors.As(err, &merr) || merr.Path != "$.temps.a" || merr.Method != "UnmarshalMarch" {
+			t.Fatalf("Got %v, expected a MethodError", err)
+		}
+		if merr.Type != reflect.TypeOf(new(Temp)) || errors.Unwrap(err) == nil {
+			t.Fatalf("Unexpected MethodError %+v", merr)
+		}
+
+		_, err = M.Marshal([]Partial{{}, {}})
+		if !errors.As(err, &merr) || merr.Path != "$[0].f" || merr.Err.Error() != "failing" {
+			t.Fatalf("Got %v, expected a MethodError", err)
+		}
+		t.Logf("March returned: %s", err.Error())
+	}
+
+	{ // Deeply nested input is a syntax error, even in a field which is not read
+		data := `{"id":1,"ignored":` + strings.Repeat("[", 3000000)
+		err := march.March{Tag: "March"}.Unmarshal([]byte(data), &Order{})
+		serr := &march.SyntaxError{}
+		if !errors.As(err, &serr) {
+			t.Fatalf("Got %v, expected a SyntaxError", err)
+		}
+	}
+}
+
+// lines is a Logger which keeps its messages
+type lines []string
+
+func (l *lines) Printf(format string, v ...interface{}) {
+	*l = append(*l, fmt.Sprintf(format, v...))
+}
+
+func TestCollect(t *testing.T) {
+	logged := &lines{}
+	M := march.March{Tag: "March", Collect: true, Verbose: true, Logger: logged}
+
+	{ // Every failed field is listed, and the rest are unmarshaled
+		data := `{"items":[{"id":"x","size":1},{"size":"y"}],"temps":{"a":"warm","b":"1C"},"pair":[1,2]}`
+		v := Order{}
+		err := M.Unmarshal([]byte(data), &v)
+		list := &march.FieldErrors{}
+		if !errors.As(err, &list) {
+			t.Fatalf("Got %v, expected FieldErrors", err)
+		}
+		paths := []string{}
+		for _, e := range list.Errors {
+			paths = append(paths, errorPath(e))
+		}
+		sort.Strings(paths)
+		if got, want := strings.Join(paths, " "), "$.id $.items[0].id $.items[1].size $.temps.a"; got != want {
+			t.Fatalf("Got errors at %s, expected %s\n%s", got, want, err.Error())
+		}
+		if len(v.Items) != 2 || v.Items[0].Size != 1 || v.Temps["b"] != 1 || v.Pair != [2]int{1, 2} {
+			t.Fatalf("Unexpected value %+v", v)
+		}
+		if len(*logged) != len(list.Errors) {
+			t.Fatalf("Got %d messages, expected %d: %v", len(*logged), len(list.Errors), *logged)
+		}
+
+		// The entries can be found with errors.Is and errors.As
+		merr := &march.MissingFieldError{}
+		if !errors.As(err, &merr) || merr.Path != "$.id" {
+			t.Fatalf("Expected to find a MissingFieldError in %v", err)
+		}
+		if !errors.Is(err, list.Errors[0]) {
+			t.Fatalf("Expected errors.Is to match an entry")
+		}
+	}
+
+	{ // Marshaling writes the fields which succeed
+		data, err := M.Marshal([]Partial{{A: 1}, {B: 2}})
+		list := &march.FieldErrors{}
+		if !errors.As(err, &list) || len(list.Errors) != 2 {
+			t.Fatalf("Got %v, expected 2 FieldErrors", err)
+		}
+		if got, want := string(data), `[{"a":1,"b":0},{"a":0,"b":2}]`; got != want {
+			t.Fatalf("Got %s, expected %s", got, want)
+		}
+	}
+}
+
+// errorPath returns the path of one of the typed errors
+func errorPath(err error) string {
+	var (
+		terr *march.UnmarshalTypeError
+		merr *march.MissingFieldError
+		cerr *march.MethodError
+	)
+	switch {
+	case errors.As(err, &cerr):
+		return cerr.Path
+	case errors.As(err, &terr):
+		return terr.Path
+	case errors.As(err, &merr):
+		return merr.Path
+	}
+	return err.Error()
+}
@@ -1,8 +1,14 @@
 package example
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	march "github.com/CreativeCactus/March"
 )
@@ -24,7 +30,7 @@ type Both struct {
 
 func TestRemains(t *testing.T) {
 	M := march.March{Tag: "March"}
-	data := `{ "V":128, "R":"actually remains", "Z":"also remains", "H2": "but also this" }`
+	data := `{ "V":128, "R":"actually remains", "Z":"also remains", "H2": 64 }`
 	v := Flags{}
 
 	err := M.Unmarshal([]byte(data), &v)
@@ -35,15 +41,18 @@ func TestRemains(t *testing.T) {
 	if want := rune(128); v.Value != want {
 		t.Fatalf("Value mismatch: Got %d, Want %d", v.Value, want)
 	}
-	if want := 0; v.Hoisted.Hoistable != want {
+	if want := 64; v.Hoisted.Hoistable != want {
 		t.Fatalf("Value mismatch: Got %d, Want %d", v.Hoisted.Hoistable, want)
 	}
-	if want := 3; len(v.Remains) != want {
+	if want := 2; len(v.Remains) != want {
 		t.Fatalf("Value mismatch: Got %d, Want %d", len(v.Remains), want)
 	}
 	if want := `"actually remains"`; string(v.Remains["R"]) != want {
 		t.Fatalf("Value mismatch: Got %s, Want %s", string(v.Remains["R"]), want)
 	}
+	if _, ok := v.Remains["H2"]; ok {
+		t.Fatalf("Hoisted field H2 should not remain")
+	}
 
 	t.Logf("March Unmarshaled: %#v\n", v)
 }
@@ -65,7 +74,7 @@ func TestHoist(t *testing.T) {
 		t.Fatalf("March Unmarshal Error: %s", err.Error())
 	}
 
-	want := `{"V":97,"R":{"test":"test"},"H2":10}`
+	want := `{"V":97,"test":"test","H2":10}`
 
 	if match, err := CompareJSON(data, []byte(want)); err != nil {
 		t.Fatalf("Failed to compare marshaled JSON: %s", err.Error())
@@ -188,3 +197,412 @@ func TestIdempotent(t *testing.T) {
 	}
 
 }
+
+type Omit struct {
+	Value   int        `March:"v,omitempty"`
+	Name    string     `March:"name,omitempty"`
+	List    []int      `March:"list,omitempty"`
+	Ptr     *int       `March:"ptr,omitempty"`
+	Time    time.Time  `March:"time,omitempty"`
+	TimePtr *time.Time `March:"tptr,omitempty"`
+	Kept    int        `March:"kept"`
+	Hoisted OmitU      `March:"_,hoist"`
+	Pointer *OmitU     `March:"_,hoist,omitempty"`
+}
+
+type OmitU struct {
+	Hoistable int `March:"h,omitempty"`
+	Other     int `March:"o"`
+}
+
+func TestOmitEmpty(t *testing.T) {
+	M := march.March{Tag: "March"}
+	{ // Empty values
+		data, err := M.Marshal(Omit{})
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		want := `{"kept":0,"o":0}`
+		if match, err := CompareJSON(data, []byte(want)); err != nil {
+			t.Fatalf("Failed to compare marshaled JSON: %s", err.Error())
+		} else if !match {
+			t.Fatalf("Value mismatch: Got %s, Want %s", string(data), want)
+		}
+	}
+	{ // Non-empty values
+		n, zero := 0, time.Time{}
+		v := Omit{
+			TimePtr: &zero, // A pointer to an empty value is not empty
+			Value:   1,
+			Name:    "a",
+			List:    []int{2},
+			Ptr:     &n,
+			Time:    time.Date(2020, 2, 2, 1, 2, 3, 0, time.UTC),
+			Hoisted: OmitU{Hoistable: 3},
+			Pointer: &OmitU{Other: 4},
+		}
+		data, err := M.Marshal(v)
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		want := `{"v":1,"name":"a","list":[2],"ptr":0,"time":"2020-02-02T01:02:03Z","tptr":"0001-01-01T00:00:00Z","kept":0,"h":3,"o":4}`
+		if match, err := CompareJSON(data, []byte(want)); err != nil {
+			t.Fatalf("Failed to compare marshaled JSON: %s", err.Error())
+		} else if !match {
+			t.Fatalf("Value mismatch: Got %s, Want %s", string(data), want)
+		}
+	}
+}
+
+type MultiHoist struct {
+	Value rune                       `March:"V"`
+	Outer *HoistOuter                `March:"_,hoist"`
+	Extra map[string]int             `March:"_,hoist"`
+	Rest  map[string]json.RawMessage `March:"_,remains"`
+}
+
+type HoistOuter struct {
+	Outer int `March:"outer"`
+	Inner U   `March:"_,hoist"`
+}
+
+func TestHoistUnmarshal(t *testing.T) {
+	M := march.March{Tag: "March", Strict: true}
+	result := `{"V":97,"outer":1,"H2":2,"x":3,"y":4}`
+	v := MultiHoist{}
+
+	if err := M.Unmarshal([]byte(result), &v); err != nil {
+		t.Fatalf("March Unmarshal Error: %s", err.Error())
+	}
+	if v.Outer == nil {
+		t.Fatalf("Hoisted pointer was not allocated")
+	}
+	if want := 1; v.Outer.Outer != want {
+		t.Fatalf("Value mismatch: Got %d, Want %d", v.Outer.Outer, want)
+	}
+	if want := 2; v.Outer.Inner.Hoistable != want {
+		t.Fatalf("Value mismatch: Got %d, Want %d", v.Outer.Inner.Hoistable, want)
+	}
+	if want := 2; len(v.Extra) != want || v.Extra["x"] != 3 || v.Extra["y"] != 4 {
+		t.Fatalf("Value mismatch: Got %#v, Want %d fields", v.Extra, want)
+	}
+	if want := 0; len(v.Rest) != want {
+		t.Fatalf("Value mismatch: Got %#v, Want %d fields", v.Rest, want)
+	}
+
+	data, err := M.Marshal(&v)
+	if err != nil {
+		t.Fatalf("March Marshal Error: %s", err.Error())
+	}
+	if match, err := CompareJSON(data, []byte(result)); err != nil {
+		t.Fatalf("Failed to compare marshaled JSON: %s", err.Error())
+	} else if !match {
+		t.Fatalf("Value mismatch: Got %s, Want %s", string(data), result)
+	}
+
+	{ // Fields which the hoisted map can not hold are left for remains, unless Strict
+		v := MultiHoist{}
+		data := `{"V":97,"x":3,"y":"four"}`
+		if err := (march.March{Tag: "March"}).Unmarshal([]byte(data), &v); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if _, stored := v.Extra["y"]; stored || v.Extra["x"] != 3 {
+			t.Fatalf("Value mismatch: Got %#v, Want only x", v.Extra)
+		}
+		if got := string(v.Rest["y"]); got != `"four"` {
+			t.Fatalf("Value mismatch: Got %q in remains, Want \"four\"", got)
+		}
+		if err := M.Unmarshal([]byte(data), &MultiHoist{}); err == nil {
+			t.Fatalf("Expected an error from a field the hoisted map can not hold")
+		}
+	}
+
+	{ // A hoisted pointer is left nil when none of its fields are present
+		v := MultiHoist{}
+		if err := M.Unmarshal([]byte(`{"V":97}`), &v); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if v.Outer != nil {
+			t.Fatalf("Hoisted pointer was allocated without data: %#v", v.Outer)
+		}
+	}
+}
+
+type Proxy struct {
+	ID    int                           `March:"id"`
+	Bytes map[string][]byte             `March:"_,remains"`
+	Raw   map[string]march.RawUnmarshal `March:"_,remains"`
+}
+
+func TestRemainsMarshal(t *testing.T) {
+	M := march.March{Tag: "March", Strict: true}
+	result := `{"id":1,"name":"passthrough","nested":{"a":[1,2]},"none":null}`
+	v := Proxy{}
+
+	if err := M.Unmarshal([]byte(result), &v); err != nil {
+		t.Fatalf("March Unmarshal Error: %s", err.Error())
+	}
+	data, err := M.Marshal(v)
+	if err != nil {
+		t.Fatalf("March Marshal Error: %s", err.Error())
+	}
+	if match, err := CompareJSON(data, []byte(result)); err != nil {
+		t.Fatalf("Failed to compare marshaled JSON: %s", err.Error())
+	} else if !match {
+		t.Fatalf("Value mismatch: Got %s, Want %s", string(data), result)
+	}
+
+	{ // Tagged fields take precedence over remains with the same name
+		v.ID = 2
+		v.Bytes["id"] = []byte(`3`)
+		data, err := M.Marshal(v)
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		want := `{"id":2,"name":"passthrough","nested":{"a":[1,2]},"none":null}`
+		if match, err := CompareJSON(data, []byte(want)); err != nil {
+			t.Fatalf("Failed to compare marshaled JSON: %s", err.Error())
+		} else if !match {
+			t.Fatalf("Value mismatch: Got %s, Want %s", string(data), want)
+		}
+	}
+}
+
+type Envelope struct {
+	Kind    string             `March:"kind"`
+	Payload march.Lazy         `March:"payload,lazy"`
+	Meta    *march.Lazy        `March:"meta,lazy"`
+	Raw     json.RawMessage    `March:"raw,lazy"`
+	Bytes   []byte             `March:"bytes,lazy"`
+	Later   march.RawUnmarshal `March:"later,lazy"`
+}
+
+func TestLazy(t *testing.T) {
+	M := march.March{Tag: "March", Strict: true}
+	result := `{"kind":"event","payload":{"a":[1,2]},"meta":"m","raw":[3],"bytes":{"b":4},"later":5}`
+	v := Envelope{}
+
+	if err := M.Unmarshal([]byte(result), &v); err != nil {
+		t.Fatalf("March Unmarshal Error: %s", err.Error())
+	}
+	if want := `{"a":[1,2]}`; string(v.Payload.Bytes) != want {
+		t.Fatalf("Value mismatch: Got %s, Want %s", string(v.Payload.Bytes), want)
+	}
+	if want := `{"b":4}`; string(v.Bytes) != want {
+		t.Fatalf("Value mismatch: Got %s, Want %s", string(v.Bytes), want)
+	}
+	if v.Payload.Decoded() {
+		t.Fatalf("Payload was decoded before Get")
+	}
+
+	{ // Decode on demand, then from the cache
+		payload := map[string][]int{}
+		if err := v.Payload.Get(&payload); err != nil {
+			t.Fatalf("Lazy Get Error: %s", err.Error())
+		}
+		if got := len(payload["a"]); got != 2 {
+			t.Fatalf("Value mismatch: Got %d elements, Want 2", got)
+		}
+		if !v.Payload.Decoded() {
+			t.Fatalf("Payload was not cached after Get")
+		}
+		again := map[string][]int{}
+		if err := v.Payload.Get(&again); err != nil {
+			t.Fatalf("Lazy Get Error: %s", err.Error())
+		}
+		if got := len(again["a"]); got != 2 {
+			t.Fatalf("Value mismatch: Got %d elements, Want 2", got)
+		}
+		meta := ""
+		if err := v.Meta.Get(&meta); err != nil {
+			t.Fatalf("Lazy Get Error: %s", err.Error())
+		} else if want := "m"; meta != want {
+			t.Fatalf("Value mismatch: Got %s, Want %s", meta, want)
+		}
+	}
+
+	{ // Raw data is written back as it is
+		data, err := M.Marshal(v)
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		if match, err := CompareJSON(data, []byte(result)); err != nil {
+			t.Fatalf("Failed to compare marshaled JSON: %s", err.Error())
+		} else if !match {
+			t.Fatalf("Value mismatch: Got %s, Want %s", string(data), result)
+		}
+	}
+
+	{ // Set replaces the raw data
+		if err := v.Payload.Set([]int{6}); err != nil {
+			t.Fatalf("Lazy Set Error: %s", err.Error())
+		}
+		data, err := M.Marshal(Envelope{Payload: v.Payload})
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		want := `{"kind":"","payload":[6],"meta":null,"raw":null,"bytes":null,"later":null}`
+		if match, err := CompareJSON(data, []byte(want)); err != nil {
+			t.Fatalf("Failed to compare marshaled JSON: %s", err.Error())
+		} else if !match {
+			t.Fatalf("Value mismatch: Got %s, Want %s", string(data), want)
+		}
+	}
+}
+
+// LazyInt has a lazy field which can not hold raw data
+type LazyInt struct {
+	N int `March:"n,lazy"`
+}
+
+func TestLazyType(t *testing.T) {
+	v := LazyInt{}
+	err := march.March{Tag: "March", Strict: true}.Unmarshal([]byte(`{"n":1}`), &v)
+	typeErr := &march.UnmarshalTypeError{}
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("Expected an UnmarshalTypeError, got %v", err)
+	} else if want := "$.n"; typeErr.Path != want {
+		t.Fatalf("Value mismatch: Got %s, Want %s", typeErr.Path, want)
+	}
+	if err := (march.March{Tag: "March"}).Unmarshal([]byte(`{"n":1}`), &v); err != nil {
+		t.Fatalf("March Unmarshal Error: %s", err.Error())
+	} else if v.N != 0 {
+		t.Fatalf("Lazy field was decoded: %d", v.N)
+	}
+}
+
+type Flagged struct {
+	Name  string `March:"name,upper,secret"`
+	Count int    `March:"count,quoted,double"`
+}
+
+func TestCustomFlags(t *testing.T) {
+	M := march.March{Tag: "March", Strict: true}
+	M.HandleFlag("upper", march.FlagHandler{
+		Describe: func(M march.March, fd *march.FieldDescriptor) {
+			fd.TagName = strings.ToUpper(fd.TagName)
+		},
+	})
+	M.HandleFlag("secret", march.FlagHandler{
+		Marshal: func(f *march.MarshalField) error {
+			f.Value = reflect.ValueOf("***")
+			return nil
+		},
+	})
+	M.HandleFlag("quoted", march.FlagHandler{
+		Marshal: func(f *march.MarshalField) error {
+			f.Data = []byte(fmt.Sprintf(`"%d"`, f.Value.Int()))
+			return nil
+		},
+		Read: func(f *march.UnmarshalField) error {
+			f.Data = bytes.Trim(f.Data, `"`)
+			return nil
+		},
+	})
+	M.HandleFlag("double", march.FlagHandler{
+		Unmarshal: func(f *march.UnmarshalField) error {
+			f.Value.SetInt(f.Value.Int() * 2)
+			return nil
+		},
+	})
+
+	v := Flagged{}
+	if err := M.Unmarshal([]byte(`{"NAME":"cactus","count":"21"}`), &v); err != nil {
+		t.Fatalf("March Unmarshal Error: %s", err.Error())
+	}
+	if want := (Flagged{Name: "cactus", Count: 42}); v != want {
+		t.Fatalf("Value mismatch: Got %#v, Want %#v", v, want)
+	}
+
+	data, err := M.Marshal(v)
+	if err != nil {
+		t.Fatalf("March Marshal Error: %s", err.Error())
+	}
+	want := `{"NAME":"***","count":"42"}`
+	if match, err := CompareJSON(data, []byte(want)); err != nil {
+		t.Fatalf("Failed to compare marshaled JSON: %s", err.Error())
+	} else if !match {
+		t.Fatalf("Value mismatch: Got %s, Want %s", string(data), want)
+	}
+
+	{ // Built-in flags can be replaced
+		M := march.March{Tag: "March"}
+		M.HandleFlag(march.FlagOmitEmpty, march.FlagHandler{})
+		data, err := M.Marshal(Omit{})
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		if !bytes.Contains(data, []byte(`"name":""`)) {
+			t.Fatalf("Replaced omitempty flag still omitted a field: %s", string(data))
+		}
+	}
+}
+
+// Window is empty when both ends are zero
+type Window struct {
+	From int `March:"from"`
+	To   int `March:"to"`
+}
+
+func (w Window) IsZero() bool { return w.From == 0 && w.To == 0 }
+
+// FlagOrder uses hoist with flags before and after it
+type FlagOrder struct {
+	Before Window `March:"_,omitempty,hoist"`
+	After  Window `March:"_,hoist,omitempty"`
+	Named  Window `March:"named,hoist,required"`
+}
+
+func TestFlagOrder(t *testing.T) {
+	M := march.March{Tag: "March", Strict: true}
+	{ // Every hook runs, whatever the order of the flags
+		data, err := M.Marshal(FlagOrder{})
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		} else if want := `{"from":0,"to":0}`; string(data) != want {
+			t.Fatalf("Value mismatch: Got %s, Want %s", string(data), want)
+		}
+		err = M.Unmarshal([]byte(`{"from":1}`), &FlagOrder{})
+		missing := &march.MissingFieldError{}
+		if !errors.As(err, &missing) {
+			t.Fatalf("Expected a MissingFieldError, got %v", err)
+		} else if want := "$.named"; missing.Path != want {
+			t.Fatalf("Value mismatch: Got %s, Want %s", missing.Path, want)
+		}
+	}
+}
+
+// TagFirst and HoistFirst have a tag with the same name as a hoisted field
+type TagFirst struct {
+	A int            `March:"a"`
+	H OmitU          `March:"_,hoist"`
+	M map[string]int `March:"_,hoist"`
+}
+
+type HoistFirst struct {
+	M map[string]int `March:"_,hoist"`
+	H OmitU          `March:"_,hoist"`
+	A int            `March:"o"`
+}
+
+func TestHoistPrecedence(t *testing.T) {
+	for _, test := range []struct {
+		M    march.March
+		v    interface{}
+		want string
+	}{
+		// A tag takes precedence over the hoisted fields of its struct, wherever it is declared
+		{march.March{Tag: "March"}, TagFirst{A: 1, H: OmitU{Hoistable: 2, Other: 3}, M: map[string]int{"a": 4}}, `{"a":1,"h":2,"o":3}`},
+		{march.March{Tag: "March"}, HoistFirst{A: 1, H: OmitU{Other: 2}, M: map[string]int{"o": 3}}, `{"o":1}`},
+		// Unless the first field is written
+		{march.March{Tag: "March", Duplicates: march.DuplicateFirst}, TagFirst{A: 1, M: map[string]int{"a": 4}}, `{"a":4,"o":0}`},
+		{march.March{Tag: "March", Duplicates: march.DuplicateFirst}, HoistFirst{A: 1, H: OmitU{Other: 2}, M: map[string]int{"o": 3}}, `{"o":3}`},
+	} {
+		data, err := test.M.Marshal(test.v)
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		} else if string(data) != test.want {
+			t.Fatalf("Value mismatch for %T: Got %s, Want %s", test.v, string(data), test.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package example
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	march "github.com/CreativeCactus/March"
+)
+
+type Holder struct {
+	Any  interface{}              `March:"any"`
+	List []interface{}            `March:"list"`
+	M2   []map[string]interface{} `March:"m2"`
+	Str  fmt.Stringer             `March:"str"`
+}
+
+func TestUnmarshalInterface(t *testing.T) {
+	M := march.March{Tag: "March", Strict: true}
+
+	{ // Generic values match encoding/json
+		data := []byte(`{"a":[1,"b",null,{"c":true}],"d":2.5}`)
+		var got, want interface{}
+		if err := M.Unmarshal(data, &got); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if err := json.Unmarshal(data, &want); err != nil {
+			t.Fatalf("JSON Unmarshal Error: %s", err.Error())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Got %#v, expected %#v", got, want)
+		}
+	}
+
+	{ // Interface fields and slices of them
+		v := Holder{}
+		data := `{"any":{"id":1},"list":[1,"x",[true]],"m2":[{"x":"y"},{"n":null}]}`
+		if err := M.Unmarshal([]byte(data), &v); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if got, want := v.Any, map[string]interface{}{"id": 1.0}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Got %#v, expected %#v", got, want)
+		}
+		if got, want := v.List, []interface{}{1.0, "x", []interface{}{true}}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Got %#v, expected %#v", got, want)
+		}
+		if got, want := v.M2, []map[string]interface{}{{"x": "y"}, {"n": nil}}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Got %#v, expected %#v", got, want)
+		}
+	}
+
+	{ // Pointers held by interfaces are unmarshaled with March
+		r := &Record{Name: "kept"}
+		temp := new(Temp)
+		v := Holder{Any: r, List: []interface{}{temp}}
+		if err := M.Unmarshal([]byte(`{"any":{"id":2}}`), &v); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if v.Any != r || r.ID != 2 {
+			t.Fatalf("Unexpected value %#v", v.Any)
+		}
+		var i interface{} = temp
+		if err := M.Unmarshal([]byte(`"12C"`), &i); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if i != temp || *temp != 12 {
+			t.Fatalf("Unexpected value %#v", i)
+		}
+		if err := M.Unmarshal([]byte(`{"any":null}`), &v); err != nil || v.Any != nil {
+			t.Fatalf("Expected null to clear the interface, got %#v (%v)", v.Any, err)
+		}
+	}
+
+	{ // Other values under a pointer are replaced, so absent fields are zero, while held pointers are kept
+		r := &Record{Name: "kept"}
+		v := Holder{Any: r, List: []interface{}{1.0}, M2: []map[string]interface{}{{"x": "y"}}}
+		if err := M.Unmarshal([]byte(`{"m2":[{"z":1}]}`), &v); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if v.Any != r || v.List != nil || !reflect.DeepEqual(v.M2, []map[string]interface{}{{"z": 1.0}}) {
+			t.Fatalf("Unexpected value %#v", v)
+		}
+
+		p := &Record{ID: 1, Name: "a", Tags: []string{"x"}}
+		if err := M.Unmarshal([]byte(`{"id":2,"tags":["y"]}`), &p); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if p.ID != 2 || p.Name != "" || !reflect.DeepEqual(p.Tags, []string{"y"}) {
+			t.Fatalf("Unexpected value %#v", p)
+		}
+
+		s := []int{1, 2, 3}
+		if err := M.Unmarshal([]byte(`[4]`), &s); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if !reflect.DeepEqual(s, []int{4}) {
+			t.Fatalf("Unexpected value %#v", s)
+		}
+
+		m := map[string]int{"a": 1}
+		if err := M.Unmarshal([]byte(`{"b":2}`), &m); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if !reflect.DeepEqual(m, map[string]int{"a": 1, "b": 2}) {
+			t.Fatalf("Unexpected value %#v", m)
+		}
+	}
+
+	{ // Generic values round trip, including nulls, and nil marshals to null
+		data := []byte(`{"a":[1,null,{"b":null}],"c":null}`)
+		var v interface{}
+		if err := M.Unmarshal(data, &v); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		back, err := M.Marshal(v)
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		} else if string(back) != string(data) {
+			t.Fatalf("Got %s, expected %s", string(back), string(data))
+		}
+		buf := &bytes.Buffer{}
+		if err = M.NewEncoder(buf).Encode(v); err != nil {
+			t.Fatalf("March Encode Error: %s", err.Error())
+		} else if buf.String() != string(data)+"\n" {
+			t.Fatalf("Got %s, expected %s", buf.String(), string(data))
+		}
+
+		if data, err = march.Marshal(nil); err != nil || string(data) != "null" {
+			t.Fatalf("Got %s (%v), expected null", string(data), err)
+		}
+		if data, err = M.Marshal([]interface{}{nil, Record{ID: 1}}); err != nil || string(data) != `[null,{"id":1,"name":"","child":null}]` {
+			t.Fatalf("Got %s (%v), expected a null element", string(data), err)
+		}
+		buf.Reset()
+		if err = M.NewEncoder(buf).Encode(nil); err != nil || buf.String() != "null\n" {
+			t.Fatalf("Got %q (%v), expected null", buf.String(), err)
+		}
+	}
+
+	{ // Non-empty interfaces can not receive generic values
+		if err := M.Unmarshal([]byte(`{"str":"x"}`), &Holder{}); err == nil {
+			t.Fatalf("Expected an error from a non-empty interface")
+		}
+	}
+}
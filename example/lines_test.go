@@ -0,0 +1,99 @@
+package example
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	march "github.com/CreativeCactus/March"
+)
+
+func TestLineReader(t *testing.T) {
+	input := `{"id":1,"name":"a","tags":["x"]}
+{"id":"bad"}
+
+{"id":3}
+not json
+{"id":5,"name":"e"}`
+
+	{ // Bad records are reported and skipped, while bad fields are ignored
+		M := march.March{Tag: "March"}
+		lr := M.NewLineReader(strings.NewReader(input))
+		bad := []int{}
+		lr.OnError = func(err *march.LineError) {
+			bad = append(bad, err.Line)
+		}
+		ids := []int{}
+		v := Record{}
+		for lr.Next(&v) {
+			ids = append(ids, v.ID)
+			if v.ID == 3 && (v.Name != "" || v.Tags != nil) {
+				t.Fatalf("Record was not reset: %+v", v)
+			}
+		}
+		if err := lr.Err(); err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		if got, want := ids, []int{1, 0, 3, 5}; !equalInts(got, want) {
+			t.Fatalf("Got records %v, expected %v", got, want)
+		}
+		if got, want := bad, []int{5}; !equalInts(got, want) {
+			t.Fatalf("Got bad lines %v, expected %v", got, want)
+		}
+	}
+
+	{ // Strict stops at the first bad record
+		M := march.March{Tag: "March", Strict: true}
+		lr := M.NewLineReader(strings.NewReader(input))
+		v := Record{}
+		n := 0
+		for lr.Next(&v) {
+			n++
+		}
+		lerr := &march.LineError{}
+		if !errors.As(lr.Err(), &lerr) {
+			t.Fatalf("Got %v, expected a LineError", lr.Err())
+		}
+		if n != 1 || lerr.Line != 2 || string(lerr.Data) != `{"id":"bad"}` {
+			t.Fatalf("Stopped after %d records at line %d (%s)", n, lerr.Line, lerr.Data)
+		}
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lw := march.NewLineWriter(buf)
+	records := []interface{}{
+		Record{ID: 1, Name: "multi\nline"},
+		&Custom{},
+		map[string]interface{}{"nested": map[string]int{"a": 1}},
+	}
+	for _, r := range records {
+		if err := lw.Write(r); err != nil {
+			t.Fatalf("Write Error: %s", err.Error())
+		}
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if len(lines) != len(records)+1 || lines[len(records)] != "" {
+		t.Fatalf("Expected %d newline terminated lines: %q", len(records), buf.String())
+	}
+
+	lr := march.NewLineReader(buf)
+	v := Record{}
+	if !lr.Next(&v) || v.Name != "multi\nline" {
+		t.Fatalf("Failed to read back record: %+v (%v)", v, lr.Err())
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,267 @@
+package example
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	march "github.com/CreativeCactus/March"
+)
+
+// Temp has custom March methods, but no JSON methods
+type Temp float64
+
+func (t Temp) MarshalMarch() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"%gC"`, float64(t))), nil
+}
+
+func (t *Temp) UnmarshalMarch(data []byte) error {
+	_, err := fmt.Sscanf(strings.Trim(string(data), `"`), "%gC", (*float64)(t))
+	return err
+}
+
+type Readings struct {
+	Temps   map[string]Temp    `March:"temps"`
+	Records map[string]*Record `March:"records"`
+}
+
+func TestMapMarshal(t *testing.T) {
+	M := march.March{Tag: "March", Strict: true}
+	v := Readings{
+		Temps:   map[string]Temp{"b": 2.5, "a": -1},
+		Records: map[string]*Record{"r": {ID: 1, Name: "x"}, "nil": nil},
+	}
+
+	data, err := M.Marshal(v.Temps)
+	if err != nil {
+		t.Fatalf("March Marshal Error: %s", err.Error())
+	}
+	if got, want := string(data), `{"a":"-1C","b":"2.5C"}`; got != want {
+		t.Fatalf("Got %s, expected %s (in order)", got, want)
+	}
+
+	data, err = M.Marshal(v)
+	if err != nil {
+		t.Fatalf("March Marshal Error: %s", err.Error())
+	}
+	want := `{"temps":{"a":"-1C","b":"2.5C"},"records":{"nil":null,"r":{"id":1,"name":"x","child":null}}}`
+	if match, err := CompareJSON(data, []byte(want)); err != nil {
+		t.Fatalf("Failed to compare marshaled JSON: %s", err.Error())
+	} else if !match {
+		t.Fatalf("Value mismatch: Got %s, Want %s", string(data), want)
+	}
+
+	{ // Nil maps and interface values
+		data, err := M.Marshal(map[string]interface{}{"r": Record{ID: 2}, "n": nil, "m": map[string]Temp(nil)})
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		want := `{"m":null,"n":null,"r":{"id":2,"name":"","child":null}}`
+		if string(data) != want {
+			t.Fatalf("Got %s, expected %s", string(data), want)
+		}
+	}
+}
+
+func TestMapUnmarshal(t *testing.T) {
+	M := march.March{Tag: "March", Strict: true}
+	data := `{"temps":{"a":"-1C","b":"2.5C"},"records":{"r":{"id":1,"name":"x"},"nil":null}}`
+
+	v := Readings{}
+	if err := M.Unmarshal([]byte(data), &v); err != nil {
+		t.Fatalf("March Unmarshal Error: %s", err.Error())
+	}
+	if len(v.Temps) != 2 || v.Temps["a"] != -1 || v.Temps["b"] != 2.5 {
+		t.Fatalf("Unexpected temps: %v", v.Temps)
+	}
+	if r := v.Records["r"]; r == nil || r.ID != 1 || r.Name != "x" {
+		t.Fatalf("Unexpected records: %v", v.Records)
+	}
+
+	{ // Existing entries are kept
+		temps := map[string]Temp{"kept": 1, "a": 0}
+		if err := M.Unmarshal([]byte(`{"a":"-1C"}`), &temps); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if len(temps) != 2 || temps["a"] != -1 || temps["kept"] != 1 {
+			t.Fatalf("Unexpected temps: %v", temps)
+		}
+	}
+
+	{ // Bad entries fail when Strict, and are skipped otherwise
+		bad := []byte(`{"a":"-1C","b":"warm"}`)
+		temps := map[string]Temp{}
+		if err := M.Unmarshal(bad, &temps); err == nil {
+			t.Fatalf("Expected an error from a bad entry")
+		}
+		temps = map[string]Temp{}
+		if err := (march.March{Tag: "March"}).Unmarshal(bad, &temps); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if _, ok := temps["b"]; len(temps) != 1 || ok {
+			t.Fatalf("Unexpected temps: %v", temps)
+		}
+	}
+
+	{ // null clears the map
+		if err := M.Unmarshal([]byte(`{"temps":null}`), &v); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if v.Temps != nil {
+			t.Fatalf("Expected a nil map, got %v", v.Temps)
+		}
+	}
+}
+
+// Point is a map key which converts itself to text
+type Point struct{ X, Y int }
+
+func (p Point) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d,%d", p.X, p.Y)), nil
+}
+
+func (p *Point) UnmarshalText(text []byte) error {
+	_, err := fmt.Sscanf(string(text), "%d,%d", &p.X, &p.Y)
+	return err
+}
+
+// Cell is a map key which only hexKeys supports
+type Cell struct {
+	Row, Col int
+}
+
+// hexKeys writes integer map keys in hexadecimal, and Cell keys as row-col
+type hexKeys struct {
+	march.TextKeyCodec
+}
+
+func (c hexKeys) MarshalKey(key reflect.Value) (string, error) {
+	if key.Kind() == reflect.Int {
+		return strconv.FormatInt(key.Int(), 16), nil
+	}
+	if cell, ok := key.Interface().(Cell); ok {
+		return fmt.Sprintf("%d-%d", cell.Row, cell.Col), nil
+	}
+	return c.TextKeyCodec.MarshalKey(key)
+}
+
+func (c hexKeys) UnmarshalKey(name string, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Int {
+		n, err := strconv.ParseInt(name, 16, 64)
+		return reflect.ValueOf(int(n)).Convert(t), err
+	}
+	if t == reflect.TypeOf(Cell{}) {
+		cell := Cell{}
+		_, err := fmt.Sscanf(name, "%d-%d", &cell.Row, &cell.Col)
+		return reflect.ValueOf(cell), err
+	}
+	return c.TextKeyCodec.UnmarshalKey(name, t)
+}
+
+// Sheet has maps keyed by Cell
+type Sheet struct {
+	Cells map[Cell]string          `March:"cells"`
+	Extra map[Cell]json.RawMessage `March:"_,remains"`
+}
+
+type Keyed struct {
+	ID     int                     `March:"id"`
+	Extra  map[int]json.RawMessage `March:"_,remains"`
+	Counts map[uint8]int           `March:"counts"`
+}
+
+func TestMapKeys(t *testing.T) {
+	M := march.March{Tag: "March", Strict: true}
+	for _, test := range []struct {
+		v    interface{}
+		want string
+	}{
+		{map[int]string{10: "a", 2: "b", -1: "c"}, `{"-1":"c","2":"b","10":"a"}`},
+		{map[uint16]bool{300: true, 7: false}, `{"7":false,"300":true}`},
+		{map[float64]int{2.5: 1, -0.5: 2, 10: 3}, `{"-0.5":2,"2.5":1,"10":3}`},
+		{map[bool]string{true: "y", false: "n"}, `{"false":"n","true":"y"}`},
+		{map[Point]int{{1, 2}: 3}, `{"1,2":3}`},
+	} {
+		data, err := M.Marshal(test.v)
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		if string(data) != test.want {
+			t.Fatalf("Got %s, expected %s", string(data), test.want)
+		}
+		back := reflect.New(reflect.TypeOf(test.v))
+		if err := M.Unmarshal(data, back.Interface()); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if !reflect.DeepEqual(back.Elem().Interface(), test.v) {
+			t.Fatalf("Got %v, expected %v", back.Elem().Interface(), test.v)
+		}
+	}
+
+	{ // Bad keys fail when Strict
+		if err := M.Unmarshal([]byte(`{"x":1}`), &map[int]int{}); err == nil {
+			t.Fatalf("Expected an error from a bad key")
+		}
+		if err := M.Unmarshal([]byte(`{"300":1}`), &map[uint8]int{}); err == nil {
+			t.Fatalf("Expected an error from an out of range key")
+		}
+	}
+
+	{ // Custom KeyCodec
+		H := march.March{Tag: "March", KeyCodec: hexKeys{}}
+		data, err := H.Marshal(map[int]string{255: "ff", 16: "10"})
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		if want := `{"10":"10","ff":"ff"}`; string(data) != want {
+			t.Fatalf("Got %s, expected %s", string(data), want)
+		}
+		v := map[int]string{}
+		if err := H.Unmarshal(data, &v); err != nil || v[255] != "ff" || v[16] != "10" {
+			t.Fatalf("Unexpected map %v (%v)", v, err)
+		}
+	}
+
+	{ // Keys which only a custom KeyCodec supports are sorted by their names
+		H := march.March{Tag: "March", KeyCodec: hexKeys{}, Strict: true}
+		sheet := Sheet{Cells: map[Cell]string{{2, 1}: "b", {1, 10}: "a"}, Extra: map[Cell]json.RawMessage{{0, 0}: json.RawMessage(`1`)}}
+		if r := H.Check(sheet); !r.OK() {
+			t.Fatalf("Unexpected issues: %s", r.String())
+		}
+		if r := M.Check(sheet); len(r.Issues) != 2 || r.Issues[0].Kind != march.IssueMapKey {
+			t.Fatalf("Expected map key issues without the KeyCodec, got %s", r.String())
+		}
+		data, err := H.Marshal(sheet)
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		if want := `{"cells":{"1-10":"a","2-1":"b"},"0-0":1}`; string(data) != want {
+			t.Fatalf("Got %s, expected %s", string(data), want)
+		}
+		back := Sheet{}
+		if err := H.Unmarshal(data, &back); err != nil || !reflect.DeepEqual(back, sheet) {
+			t.Fatalf("Got %+v, expected %+v (%v)", back, sheet, err)
+		}
+	}
+
+	{ // Remains with integer keys skip names which are not integers
+		v := Keyed{}
+		data := `{"id":1,"counts":{"2":3},"7":"seven","x":"skipped"}`
+		if err := (march.March{Tag: "March"}).Unmarshal([]byte(data), &v); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if len(v.Extra) != 1 || string(v.Extra[7]) != `"seven"` || v.Counts[2] != 3 {
+			t.Fatalf("Unexpected value %+v", v)
+		}
+		out, err := M.Marshal(v)
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		if want := `{"id":1,"counts":{"2":3},"7":"seven"}`; string(out) != want {
+			t.Fatalf("Got %s, expected %s", string(out), want)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package example
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -103,8 +105,8 @@ func TestMarshalSlice(t *testing.T) {
 			t.Fatalf("Error from march marshal:\n\t%s", err.Error())
 		}
 		expect := `[
-			{"int":1, "nest":{"nest":0},"custom":null,"ptrs":null,"m1":null,"m2":[],"s":"","-":0},
-			{"int":2, "nest":{"nest":0},"custom":null,"ptrs":null,"m1":null,"m2":[],"s":"","-":0}
+			{"int":1, "nest":{"nest":0},"custom":null,"ptrs":null,"m1":null,"m2":[],"s":"","-":0,"deep":0,"embedded":0},
+			{"int":2, "nest":{"nest":0},"custom":null,"ptrs":null,"m1":null,"m2":[],"s":"","-":0,"deep":0,"embedded":0}
 		]`
 		if match, err := CompareJSON(data, []byte(expect)); err != nil {
 			t.Fatalf("Failed to compare JSON: %s\n\tGot: %s", err.Error(), string(data))
@@ -133,3 +135,51 @@ func TestMarshalComposite(t *testing.T) {
 	t.Logf("March marshaled time as expected: %s\n", string(data))
 
 }
+
+type Ordered struct {
+	Z     int         `March:"z"`
+	Dot   int64       `March:"data.v"`
+	Multi MultiHoist  `March:"_,hoist"`
+	A     string      `March:"a"`
+	Dot2  int64       `March:"data.b"`
+	M     map[int]int `March:"m"`
+}
+
+func TestMarshalOrder(t *testing.T) {
+	M := march.March{Tag: "March"}
+	v := Ordered{
+		Z: 1, Dot: 2, A: "a", Dot2: 3,
+		Multi: MultiHoist{
+			Value: 4,
+			Outer: &HoistOuter{Outer: 5, Inner: U{Hoistable: 6}},
+			Extra: map[string]int{"y": 7, "x": 8},
+			Rest:  map[string]json.RawMessage{"r": []byte("9")},
+		},
+		M: map[int]int{10: 1, 9: 2, -1: 3},
+	}
+	want := `{"z":1,"data":{"v":2,"b":3},"V":4,"outer":5,"H2":6,"x":8,"y":7,"a":"a","m":{"-1":3,"9":2,"10":1},"r":9}`
+	for i := 0; i < 10; i++ { // Map iteration order would vary between runs
+		data, err := M.Marshal(v)
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		if string(data) != want {
+			t.Fatalf("Got %s, expected %s", string(data), want)
+		}
+	}
+
+	{ // The Encoder writes the same bytes
+		v := []Record{{ID: 1, Name: "a", Tags: []string{"t"}, Child: &Record{ID: 2}}}
+		want, err := M.Marshal(v)
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		buf := &strings.Builder{}
+		if err := M.NewEncoder(buf).Encode(v); err != nil {
+			t.Fatalf("Encode Error: %s", err.Error())
+		}
+		if got := strings.TrimSuffix(buf.String(), "\n"); got != string(want) {
+			t.Fatalf("Got %s, expected %s", got, string(want))
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package example
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	march "github.com/CreativeCactus/March"
+)
+
+// Listed reads and writes its fields with the ordered Fields type
+type Listed struct {
+	Z int `March:"z"`
+	A int `March:"a"`
+	M int `March:"m"`
+}
+
+// WriteFieldsMarch writes a version before the fields, and drops m
+func (Listed) WriteFieldsMarch(fields march.Fields) ([]byte, error) {
+	fields = append(march.Fields{{Name: "version", Data: []byte(`1`)}}, fields...)
+	fields.Delete("m")
+	return march.WriteOrderedFieldsJSON(fields)
+}
+
+// ReadFieldsMarch lists every field of an object in order, including duplicates
+func (Listed) ReadFieldsMarch(data []byte) (fields march.Fields, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err = dec.Token(); err != nil {
+		return
+	}
+	for dec.More() {
+		var key json.Token
+		if key, err = dec.Token(); err != nil {
+			return
+		}
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return
+		}
+		fields.Add(key.(string), value)
+	}
+	return
+}
+
+// BadW has a WriteFieldsMarch method which takes no fields
+type BadW struct {
+	V int `March:"v"`
+}
+
+func (BadW) WriteFieldsMarch() ([]byte, error) { return nil, nil }
+
+func TestFields(t *testing.T) {
+	M := march.March{Tag: "March", StrictSignatures: true}
+	if err := M.Check(Listed{}).Err(); err != nil {
+		t.Fatalf("Unexpected issues: %s", err.Error())
+	}
+
+	{ // WriteFieldsX receives the fields in declaration order
+		data, err := M.Marshal(Listed{Z: 1, A: 2, M: 3})
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		} else if want := `{"version":1,"z":1,"a":2}`; string(data) != want {
+			t.Fatalf("Value mismatch: Got %s, Want %s", string(data), want)
+		}
+	}
+	{ // Fields returned by ReadFieldsX are unmarshaled with the last of each name
+		v := Listed{}
+		if err := M.Unmarshal([]byte(`{"a":1,"z":2,"a":3}`), &v); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		} else if want := (Listed{Z: 2, A: 3}); v != want {
+			t.Fatalf("Value mismatch: Got %+v, Want %+v", v, want)
+		}
+	}
+	{ // Repeated names are resolved by M.Duplicates
+		data := []byte(`{"a":1,"z":2,"a":3}`)
+		M := march.March{Tag: "March", Duplicates: march.DuplicateFirst}
+		v := Listed{}
+		if err := M.Unmarshal(data, &v); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		} else if want := (Listed{Z: 2, A: 1}); v != want {
+			t.Fatalf("Value mismatch: Got %+v, Want %+v", v, want)
+		}
+
+		M.Duplicates = march.DuplicateError
+		v = Listed{}
+		if err := M.Unmarshal(data, &v); err != nil { // Skipped, since not Strict
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		} else if want := (Listed{Z: 2, A: 1}); v != want {
+			t.Fatalf("Value mismatch: Got %+v, Want %+v", v, want)
+		}
+		M.Strict = true
+		var derr *march.DuplicateFieldError
+		if err := M.Unmarshal(data, &Listed{}); !errors.As(err, &derr) || derr.Path != "$.a" {
+			t.Fatalf("Expected a DuplicateFieldError at $.a, got %v", err)
+		}
+	}
+	{ // A WriteFieldsX method with the wrong signature is ignored, or a SignatureError
+		data, err := march.March{Tag: "March"}.Marshal(BadW{V: 1})
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		} else if want := `{"v":1}`; string(data) != want {
+			t.Fatalf("Value mismatch: Got %s, Want %s", string(data), want)
+		}
+		var serr *march.SignatureError
+		if _, err = M.Marshal(BadW{}); !errors.As(err, &serr) {
+			t.Fatalf("Expected a SignatureError, got %v", err)
+		}
+	}
+	{ // The map form keeps working
+		data, err := M.Marshal(UpperWriter{V: 1})
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		} else if want := `{"V":1}`; string(data) != want {
+			t.Fatalf("Value mismatch: Got %s, Want %s", string(data), want)
+		}
+	}
+
+	fields, err := Listed{}.ReadFieldsMarch([]byte(`{"b":1,"a":2,"b":3,"c":4}`))
+	if err != nil {
+		t.Fatalf("ReadFieldsMarch Error: %s", err.Error())
+	}
+	if data, ok := fields.Get("b"); !ok || string(data) != `1` {
+		t.Fatalf("Value mismatch: Got %s (%v), Want 1", string(data), ok)
+	}
+	if _, ok := fields.Get("z"); ok {
+		t.Fatalf("Unexpected field z")
+	}
+	if got, want := fields.Values("b"), [][]byte{[]byte(`1`), []byte(`3`)}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Value mismatch: Got %s, Want %s", got, want)
+	}
+	if got, want := fields.Names(), []string{"b", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Value mismatch: Got %v, Want %v", got, want)
+	}
+	if got, want := fields.Duplicates(), []string{"b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Value mismatch: Got %v, Want %v", got, want)
+	}
+	if got := fields.Map(); string(got["b"]) != `3` || len(got) != 3 {
+		t.Fatalf("Value mismatch: Got %s, Want the last b of 3 fields", got)
+	}
+
+	fields.Set("b", []byte(`5`))
+	fields.Set("d", []byte(`6`))
+	fields.Delete("a")
+	data, _ := march.WriteOrderedFieldsJSON(fields)
+	if want := `{"b":5,"c":4,"d":6}`; string(data) != want {
+		t.Fatalf("Value mismatch: Got %s, Want %s", string(data), want)
+	}
+
+	data, _ = march.WriteOrderedFieldsJSON(march.FieldsFromMap(map[string][]byte{"y": []byte(`1`), "x": []byte(`2`)}))
+	if want := `{"x":2,"y":1}`; string(data) != want {
+		t.Fatalf("Value mismatch: Got %s, Want %s", string(data), want)
+	}
+}
@@ -0,0 +1,70 @@
+package example
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	march "github.com/CreativeCactus/March"
+)
+
+// BadRemains has a remains field of an unsupported type, which panics
+type BadRemains struct {
+	Extra map[string]int `March:"_,remains"`
+}
+
+// Panics has a custom marshaler which panics
+type Panics struct {
+	P *int
+}
+
+func (p Panics) MarshalMarch() ([]byte, error) {
+	return []byte{byte(*p.P)}, nil
+}
+
+type PanicHolder struct {
+	ID     int        `March:"id"`
+	Bad    BadRemains `March:"bad"`
+	Panics []Panics   `March:"panics"`
+}
+
+func TestPanicError(t *testing.T) {
+	M := march.March{Tag: "March"}
+
+	{ // Unmarshal
+		err := M.Unmarshal([]byte(`{"id":1,"bad":{"x":1}}`), &PanicHolder{})
+		perr := &march.PanicError{}
+		if !errors.As(err, &perr) {
+			t.Fatalf("Got %v, expected a PanicError", err)
+		}
+		if perr.Path != "$.bad" || perr.Type != reflect.TypeOf(BadRemains{}) || len(perr.Stack) == 0 {
+			t.Fatalf("Unexpected PanicError at %s (%s)", perr.Path, perr.Type)
+		}
+	}
+
+	{ // Marshal, even when the field error would be skipped
+		_, err := M.Marshal(PanicHolder{Panics: []Panics{{}}})
+		perr := &march.PanicError{}
+		if !errors.As(err, &perr) || perr.Path != "$.panics[0]" {
+			t.Fatalf("Got %v, expected a PanicError", err)
+		}
+		rerr := (runtime.Error)(nil)
+		if !errors.As(err, &rerr) || !strings.Contains(string(perr.Stack), "MarshalMarch") {
+			t.Fatalf("Expected the runtime error and stack of the panic, got %v", err)
+		}
+		if err := M.NewEncoder(&strings.Builder{}).Encode(PanicHolder{Panics: []Panics{{}}}); !errors.As(err, &perr) || perr.Path != "$.panics[0]" {
+			t.Fatalf("Got %v, expected a PanicError from Encode", err)
+		}
+	}
+
+	{ // NoRecover
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("Expected a panic")
+			}
+		}()
+		march.March{Tag: "March", NoRecover: true}.Marshal(Panics{})
+	}
+}
@@ -0,0 +1,66 @@
+package example
+
+import (
+	"testing"
+
+	march "github.com/CreativeCactus/March"
+)
+
+type Dotted struct {
+	V    int64  `March:"data.v"`
+	W    int64  `March:"data.w"`
+	Deep string `March:"data.deep.x"`
+	X    string `March:"list[0]"`
+	Y    string `March:"list[2]"`
+	Z    int    `March:"grid[1][0].z"`
+}
+
+func TestDotNotationMarshal(t *testing.T) {
+	M := march.March{Tag: "March", Strict: true}
+	v := Dotted{V: 1, W: 2, Deep: "d", X: "x", Y: "y", Z: 3}
+
+	data, err := M.Marshal(v)
+	if err != nil {
+		t.Fatalf("March Marshal Error: %s", err.Error())
+	}
+	want := `{"data":{"v":1,"w":2,"deep":{"x":"d"}},"list":["x",null,"y"],"grid":[null,[{"z":3}]]}`
+	if match, err := CompareJSON(data, []byte(want)); err != nil {
+		t.Fatalf("Failed to compare marshaled JSON: %s", err.Error())
+	} else if !match {
+		t.Fatalf("Value mismatch: Got %s, Want %s", string(data), want)
+	}
+	t.Logf("March Marshaled: %s\n", data)
+}
+
+func TestDotNotationUnmarshal(t *testing.T) {
+	M := march.March{Tag: "March", Strict: true}
+	{ // Complete
+		data := `{"data":{"v":1,"w":2,"deep":{"x":"d"}},"list":["x",null,"y"],"grid":[null,[{"z":3}]]}`
+		v := Dotted{}
+		if err := M.Unmarshal([]byte(data), &v); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		want := Dotted{V: 1, W: 2, Deep: "d", X: "x", Y: "y", Z: 3}
+		if v != want {
+			t.Fatalf("Value mismatch: Got %#v, Want %#v", v, want)
+		}
+	}
+	{ // Missing intermediate objects and elements
+		data := `{"data":{"w":2},"list":["x"],"grid":null}`
+		v := Dotted{}
+		if err := M.Unmarshal([]byte(data), &v); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		want := Dotted{W: 2, X: "x"}
+		if v != want {
+			t.Fatalf("Value mismatch: Got %#v, Want %#v", v, want)
+		}
+	}
+	{ // Intermediate values of the wrong type
+		data := `{"data":"not an object"}`
+		v := Dotted{}
+		if err := M.Unmarshal([]byte(data), &v); err == nil {
+			t.Fatalf("Expected an error for a non-object intermediate value")
+		}
+	}
+}
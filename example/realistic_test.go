@@ -61,7 +61,7 @@ func TestRuntimeReadRemains(t *testing.T) {
 	}
 	{ // Lazy unmarshal invalid type
 		n := 0
-		expect := `json: cannot unmarshal string into Go value of type int`
+		expect := `$: json: cannot unmarshal string into Go value of type int`
 		err := x.Extras["string"].UnmarshalTo(&n)
 		if err == nil {
 			t.Fatalf("Expected error(%s), got nil", expect)
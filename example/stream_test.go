@@ -0,0 +1,176 @@
+package example
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	march "github.com/CreativeCactus/March"
+)
+
+type Record struct {
+	ID    int      `March:"id"`
+	Name  string   `March:"name"`
+	Tags  []string `March:"tags,omitempty"`
+	Child *Record  `March:"child"`
+}
+
+// Failing can not be marshaled
+type Failing struct{}
+
+func (Failing) MarshalMarch() ([]byte, error) { return nil, errors.New("failing") }
+
+type Partial struct {
+	A int     `March:"a"`
+	F Failing `March:"f"`
+	B int     `March:"b"`
+}
+
+// Batch holds its records in a field
+type Batch struct {
+	Name    string        `March:"name"`
+	Records []interface{} `March:"records"`
+}
+
+// countingWriter records the number of calls to Write, and the largest
+type countingWriter struct {
+	bytes.Buffer
+	writes  int
+	largest int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if len(p) > w.largest {
+		w.largest = len(p)
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestEncoder(t *testing.T) {
+	M := march.March{Tag: "March"}
+
+	{ // Values are written one per line, and match Marshal
+		buf := &bytes.Buffer{}
+		enc := M.NewEncoder(buf)
+		values := []interface{}{
+			Record{ID: 1, Name: "a", Child: &Record{ID: 2, Tags: []string{"x"}}},
+			[]Record{{ID: 3}, {ID: 4}},
+			Flags{Value: 1, Hoisted: U{Hoistable: 2}}, // Not streamable, so marshaled as a whole
+			Dotted{V: 1},
+			"text",
+		}
+		for _, v := range values {
+			if err := enc.Encode(v); err != nil {
+				t.Fatalf("Encode Error: %s", err.Error())
+			}
+		}
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if len(lines) != len(values) {
+			t.Fatalf("Got %d lines, expected %d: %s", len(lines), len(values), buf.String())
+		}
+		for i, v := range values {
+			want, err := M.Marshal(v)
+			if err != nil {
+				t.Fatalf("March Marshal Error: %s", err.Error())
+			}
+			if match, err := CompareJSON([]byte(lines[i]), want); err != nil {
+				t.Fatalf("Failed to compare encoded JSON: %s", err.Error())
+			} else if !match {
+				t.Fatalf("Value mismatch: Got %s, Want %s", lines[i], string(want))
+			}
+		}
+	}
+
+	{ // Large values are written as they go
+		records := make([]Record, 1000)
+		for i := range records {
+			records[i] = Record{ID: i, Name: "record"}
+		}
+		w := &countingWriter{}
+		if err := M.NewEncoder(w).Encode(records); err != nil {
+			t.Fatalf("Encode Error: %s", err.Error())
+		}
+		if w.writes < 2 {
+			t.Fatalf("Got %d writes, expected the output to be streamed", w.writes)
+		}
+		decoded := []Record{}
+		if err := M.Unmarshal(w.Bytes(), &decoded); err != nil {
+			t.Fatalf("March Unmarshal Error: %s", err.Error())
+		}
+		if len(decoded) != len(records) || decoded[999].ID != 999 {
+			t.Fatalf("Decoded %d records, expected %d", len(decoded), len(records))
+		}
+	}
+
+	{ // Large fields are written as they go, even when not Strict
+		batch := Batch{Name: "batch"}
+		for i := 0; i < 1000; i++ {
+			batch.Records = append(batch.Records, Record{ID: i, Name: "record"})
+		}
+		w := &countingWriter{}
+		if err := M.NewEncoder(w).Encode(batch); err != nil {
+			t.Fatalf("Encode Error: %s", err.Error())
+		}
+		if w.writes < 2 || w.largest > 8192 {
+			t.Fatalf("Got %d writes of up to %d bytes, expected the output to be streamed", w.writes, w.largest)
+		}
+		want, err := M.Marshal(batch)
+		if err != nil {
+			t.Fatalf("March Marshal Error: %s", err.Error())
+		}
+		if w.String() != string(want)+"\n" {
+			t.Fatalf("Value mismatch: Got %s, Want %s", w.String(), string(want))
+		}
+
+		// A field which fails after part of it was written can not be skipped
+		batch.Records = append(batch.Records, Failing{})
+		if err = M.NewEncoder(&countingWriter{}).Encode(batch); err == nil {
+			t.Fatalf("Expected an error from a partly written field")
+		}
+		t.Logf("March returned: %s", err.Error())
+	}
+
+	{ // Failing fields are skipped, unless Strict
+		buf := &bytes.Buffer{}
+		if err := M.NewEncoder(buf).Encode(Partial{A: 1, B: 2}); err != nil {
+			t.Fatalf("Encode Error: %s", err.Error())
+		}
+		if got, want := buf.String(), "{\"a\":1,\"b\":2}\n"; got != want {
+			t.Fatalf("Got %q, expected %q", got, want)
+		}
+		strict := march.March{Tag: "March", Strict: true}
+		if err := strict.NewEncoder(&bytes.Buffer{}).Encode(Partial{}); err == nil {
+			t.Fatalf("Expected an error from a failing field")
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	M := march.March{Tag: "March"}
+	input := `{"id":1,"name":"a"} {"id":2,"child":{"id":3}}
+[1,2]`
+	dec := M.NewDecoder(strings.NewReader(input))
+
+	a, b, c := Record{}, Record{}, []int{}
+	for _, v := range []interface{}{&a, &b, &c} {
+		if !dec.More() {
+			t.Fatalf("Expected more values")
+		}
+		if err := dec.Decode(v); err != nil {
+			t.Fatalf("Decode Error: %s", err.Error())
+		}
+	}
+	if a.ID != 1 || a.Name != "a" || b.Child == nil || b.Child.ID != 3 || len(c) != 2 {
+		t.Fatalf("Unexpected values %+v %+v %v", a, b, c)
+	}
+	if err := dec.Decode(&a); err != io.EOF {
+		t.Fatalf("Got %v, expected EOF", err)
+	}
+
+	if err := M.NewDecoder(strings.NewReader(`{"id":`)).Decode(&a); err == nil {
+		t.Fatalf("Expected an error from truncated input")
+	}
+}
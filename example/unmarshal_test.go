@@ -87,7 +87,9 @@ func TestUnmarshal(t *testing.T) {
 		"m1":{"b":123,"c":99999, "d": 0},
 		"m2": [{"x":"y"}],
 		"s": "A",
-		"-":0
+		"-":0,
+		"deep":0,
+		"embedded":0
 	}`)
 	if match, err := CompareJSON(js, s); err != nil {
 		t.Fatalf("Failed to compare marshaled JSON: %s", err.Error())
@@ -98,9 +100,9 @@ func TestUnmarshal(t *testing.T) {
 	}
 }
 
-// TestUnmarshalStrictNoEmbedded confirms that embedded fields CANNOT
-// be unmarshaled onto.
-func TestUnmarshalStrictNoEmbedded(t *testing.T) {
+// TestUnmarshalEmbedded confirms that the fields of embedded structs
+// are promoted and unmarshaled onto.
+func TestUnmarshalEmbedded(t *testing.T) {
 	M := march.March{Tag: "March"}
 	data := `{ "embedded": 3, "deep": 4 }`
 
@@ -117,7 +119,7 @@ func TestUnmarshalStrictNoEmbedded(t *testing.T) {
 	t.Logf("March: %s\n", s)
 
 	// Compare...
-	js := []byte(`{"deep":0,"embedded":0}`)
+	js := []byte(`{"deep":4,"embedded":3}`)
 	if match, err := CompareJSON(js, s); err != nil {
 		t.Fatalf("Failed to compare JSON: %s", err.Error())
 
@@ -212,7 +214,7 @@ func TestUnmarshalArrayFail(t *testing.T) {
 	var v [2]string
 	err := M.Unmarshal([]byte(data), &v)
 	// Compare...
-	expect := `Default JSON unmarshaler does not support array types. Use a slice`
+	expect := `$: Sequence of length 0 is too short for [2]string`
 	if err == nil {
 		t.Fatalf("No error from march unmarshal, expected:\n\t%s", expect)
 	} else if got := err.Error(); got != expect {
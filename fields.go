@@ -49,6 +49,40 @@ func IsValidTagName(tag string) bool {
 	return len(tag) > 0
 }
 
+// IsEmptyValue reports whether v is empty for the purposes of FlagOmitEmpty.
+// It follows the rules of encoding/json (false, 0, nil and zero length values are empty),
+// and additionally respects an `IsZero() bool` method on v or *v, such as that of time.Time.
+// As in encoding/json, a non-nil pointer or interface is never empty, even if it points to an empty value.
+func IsEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	if v.CanInterface() {
+		if z, ok := v.Interface().(interface{ IsZero() bool }); ok {
+			return z.IsZero()
+		}
+	}
+	if v.CanAddr() && v.Addr().CanInterface() {
+		if z, ok := v.Addr().Interface().(interface{ IsZero() bool }); ok {
+			return z.IsZero()
+		}
+	}
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	}
+	return false
+}
+
 // Data types
 
 // FieldDescriptor is a generic form of reflect.StructField which can be used for
@@ -58,6 +92,7 @@ type FieldDescriptor struct {
 	Kind     reflect.Kind
 	Tag      string
 	TagName  string
+	TagPath  []PathStep
 	TagFlags []string
 }
 
@@ -85,6 +120,7 @@ func FieldDescriptorFromStructField(sf reflect.StructField, tagKey string) (fd F
 	return FieldDescriptor{
 		Tag:      tag,
 		TagName:  tagName,
+		TagPath:  ParseTagPath(tagName),
 		TagFlags: GetTagFlags(tag),
 		Type:     t,
 		Kind:     k,
@@ -115,8 +151,14 @@ func FieldDescriptorFromSlice(sf reflect.Value, key int, tagKey string) (fd Fiel
 }
 
 // FieldDescriptorFromMap converts a Map into a FieldDescriptor.
+// The tag name is the key as converted by TextKeyCodec, if key is a reflect.Value which it supports.
 func FieldDescriptorFromMap(sf reflect.Value, key interface{}, tagKey string) (fd FieldDescriptor, ok bool) {
-	tag := fmt.Sprintf("%v", key) //
+	tag := fmt.Sprintf("%v", key)
+	if kv, isValue := key.(reflect.Value); isValue {
+		if name, err := (TextKeyCodec{}).MarshalKey(kv); err == nil {
+			tag = name
+		}
+	}
 	t := sf.Type()
 	k := t.Kind()
 
@@ -197,7 +239,11 @@ func (V Values) Len() int { return len(V) }
 func (V Values) Swap(i, j int) { V[i], V[j] = V[j], V[i] }
 
 // Less implements sorting, returns true if Vi < Vj AKA A < B
+// Numbers and bools are compared by value, and other keys by their bytes (see KeyToBytes).
 func (V Values) Less(i, j int) bool {
+	if less, ok := lessKeys(V[i], V[j]); ok {
+		return less
+	}
 	A := KeyToBytes(V[i])
 	B := KeyToBytes(V[j])
 	for n := range A {
@@ -216,20 +262,16 @@ func (V Values) Less(i, j int) bool {
 }
 
 // KeyToBytes handles conversion from any reflect.Value which can be
-// a map key into a []byte for ordering.
+// a map key into a []byte for ordering. See TextKeyCodec for the supported types.
 func KeyToBytes(v reflect.Value) []byte {
-	// If you followed a stack trace to get here, you are now cursed.
-	// Please implement support for a type to be freed.
-
-	t := v.Type()
-	k := v.Kind()
-	if (k == reflect.Array || k == reflect.Slice) && t.Elem().Kind() == reflect.Uint8 {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
 		return v.Bytes()
 	}
-	if k == reflect.String {
-		return []byte(v.String())
+	name, err := TextKeyCodec{}.MarshalKey(v)
+	if err != nil {
+		panic(fmt.Sprintf("Attempted to get bytes from map key: %s", err.Error()))
 	}
-	panic(fmt.Sprintf("Attempted to get bytes from unknown map key type %s.", t.Name()))
+	return []byte(name)
 }
 
 // TotalFields counts the fields in the collective list
@@ -0,0 +1,278 @@
+package march
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// FlagHandler implements the behavior of a tag flag in the default un/marshalers.
+// Every hook is optional. For each field, the hooks of its flags are called in the order the flags appear in the tag.
+// Every hook is called, even once an earlier hook has set Omit or Handled, so hooks which do work should check them.
+// The built-in flags (hoist, remains, lazy, omitempty, required) are implemented as FlagHandlers,
+// and can be replaced by registering a handler with the same name.
+type FlagHandler struct {
+	// Describe may change the FieldDescriptor of a flagged field before it is un/marshaled.
+	// It is called before any other hook, and may add or remove flags.
+	Describe func(M March, fd *FieldDescriptor)
+	// Marshal is called with the value of a flagged field before it is marshaled.
+	Marshal func(f *MarshalField) error
+	// Read is called with the raw data of a flagged field (from ReadFields) before it is unmarshaled.
+	Read func(f *UnmarshalField) error
+	// Unmarshal is called with the value of a flagged field after it is unmarshaled.
+	Unmarshal func(f *UnmarshalField) error
+}
+
+// HandleFlag registers a FlagHandler for the given flag name on M,
+// replacing any built-in or previously registered handler.
+func (M *March) HandleFlag(flag string, h FlagHandler) {
+	if M.Flags == nil {
+		M.Flags = map[string]FlagHandler{}
+	}
+	M.Flags[flag] = h
+}
+
+// FlagHandler returns the handler registered on M for the given flag,
+// or the built-in handler. Ok is false if there is no handler for the flag.
+func (M March) FlagHandler(flag string) (h FlagHandler, ok bool) {
+	if h, ok = M.Flags[flag]; ok {
+		return
+	}
+	switch flag {
+	case FlagHoist:
+		return hoistFlag(), true
+	case FlagRemain:
+		return remainsFlag(), true
+	case FlagLazy:
+		return lazyFlag(), true
+	case FlagOmitEmpty:
+		return omitEmptyFlag(), true
+	case FlagRequired:
+		return requiredFlag(), true
+	}
+	return
+}
+
+// describe applies the Describe hooks for the flags of fd,
+// and returns the resulting descriptor along with the handlers of its flags.
+func (M March) describe(fd FieldDescriptor) (FieldDescriptor, []FlagHandler) {
+	name := fd.TagName
+	for _, flag := range fd.TagFlags {
+		if h, ok := M.FlagHandler(flag); ok && h.Describe != nil {
+			h.Describe(M, &fd)
+		}
+	}
+	if fd.TagName != name {
+		fd.TagPath = ParseTagPath(fd.TagName)
+	}
+	handlers := []FlagHandler{}
+	for _, flag := range fd.TagFlags {
+		if h, ok := M.FlagHandler(flag); ok {
+			handlers = append(handlers, h)
+		}
+	}
+	return fd, handlers
+}
+
+// MarshalField is the state of a single field being marshaled, which is passed to FlagHandler.Marshal.
+type MarshalField struct {
+	March      March
+	Descriptor FieldDescriptor
+	Value      reflect.Value // The value to marshal, which may be replaced
+	Data       []byte        // If set, this data is written as it is instead of marshaling Value
+	Omit       bool          // If set, nothing is written for this field, including any values it hoists
+
+	out    *structOutput
+	hoists []reflect.Value
+}
+
+// Hoist marshals the fields of v (a struct, map or pointer to either) as if they belonged to the parent of this field,
+// in place of this field. They are marshaled once every hook of this field has been called, unless Omit is set.
+// A field of the parent ranks after the fields it hoists, so by default it replaces them (see DuplicatePolicy).
+func (f *MarshalField) Hoist(v reflect.Value) error {
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	f.hoists = append(f.hoists, v)
+	return nil
+}
+
+// After registers fn to be called once all fields of the parent are marshaled,
+// with the fields which will be written.
+func (f *MarshalField) After(fn func(fields map[string][]byte) error) {
+	f.out.after = append(f.out.after, fn)
+}
+
+// UnmarshalField is the state of a single field being unmarshaled, which is passed to FlagHandler.Read and FlagHandler.Unmarshal.
+type UnmarshalField struct {
+	March      March
+	Descriptor FieldDescriptor
+	Value      reflect.Value // The field, which can be set
+	Data       []byte        // The raw data for the field, which may be replaced
+	Found      bool          // Whether Data was present in the input
+	Handled    bool          // If set, the field is not unmarshaled
+	Unclaimed  bool          // If set, the tag name does not claim a field of the input, leaving it for remains
+
+	in *structInput
+}
+
+// Hoist unmarshals the input of the parent onto the fields of v (a struct or pointer to one),
+// as if they belonged to the parent of this field.
+// A nil pointer is only allocated if one of its fields is present.
+func (f *UnmarshalField) Hoist(v reflect.Value) error {
+	return f.March.unmarshalJSONHoisted(v, f.in)
+}
+
+// Claim marks a field of the input as used, so that it is not passed to remains.
+func (f *UnmarshalField) Claim(name string) {
+	f.in.claimed[name] = true
+}
+
+// After registers fn to be called once all fields of the parent are unmarshaled,
+// with the input fields which are not claimed.
+func (f *UnmarshalField) After(fn func(unclaimed map[string][]byte) error) {
+	f.in.after = append(f.in.after, fn)
+}
+
+// Finally registers fn to be called after every function registered with After,
+// with the input fields which are still not claimed.
+func (f *UnmarshalField) Finally(fn func(unclaimed map[string][]byte) error) {
+	f.in.finally = append(f.in.finally, fn)
+}
+
+// Built-in flags
+
+// hoistFlag brings the fields of a struct or map into the parent.
+// A field which also has the remains flag is left to that flag.
+func hoistFlag() FlagHandler {
+	return FlagHandler{
+		Marshal: func(f *MarshalField) error {
+			if f.Descriptor.FlagsContain(FlagRemain) {
+				return nil
+			}
+			return f.Hoist(f.Value)
+		},
+		Read: func(f *UnmarshalField) error {
+			if f.Descriptor.FlagsContain(FlagRemain) {
+				return nil
+			}
+			f.Handled = true
+			f.Unclaimed = true
+			if f.Value.Kind() != reflect.Map {
+				return f.Hoist(f.Value)
+			}
+			// Maps receive any fields which are not claimed by other fields
+			value := f.Value
+			f.After(func(unclaimed map[string][]byte) error {
+				if value.IsNil() {
+					value.Set(reflect.MakeMap(value.Type()))
+				}
+				for k, data := range unclaimed {
+					key, err := f.March.unmarshalKey(k, value.Type().Key())
+					if err != nil {
+						continue // Not a valid key, so it is left for remains
+					}
+					elem := reflect.New(value.Type().Elem()).Elem()
+					if err = f.March.Unmarshal(data, &elem); err != nil {
+						if err = f.March.fieldError(&f.in.errs, k, withPath(err, fieldStep(k))); err != nil {
+							return err
+						}
+						continue // Not a valid value, so it is left for remains
+					}
+					value.SetMapIndex(key, elem)
+					f.Claim(k)
+				}
+				return nil
+			})
+			return nil
+		},
+	}
+}
+
+// remainsFlag receives the fields of the input which no other field claimed,
+// and writes them back at the top level. Any other field with the same name replaces them, see DuplicatePolicy.
+func remainsFlag() FlagHandler {
+	return FlagHandler{
+		Marshal: func(f *MarshalField) error {
+			f.Omit = true
+			value := f.Value
+			if value.Kind() != reflect.Map {
+				panic(fmt.Sprintf("Marshal remaining fields from unsupported type %s", value.Type().Name()))
+			}
+			f.After(func(fields map[string][]byte) (err error) {
+				var keys []mapKey
+				if keys, err = f.March.sortedKeys(value); err != nil {
+					return
+				}
+				for _, key := range keys {
+					var data []byte
+					if data, err = f.March.marshalRaw(value.MapIndex(key.key)); err != nil {
+						return
+					}
+					if err = f.March.fieldError(&f.out.errs, key.name, f.out.set(f.March, key.name, data, rankRemains)); err != nil {
+						return
+					}
+				}
+				return
+			})
+			return nil
+		},
+		Read: func(f *UnmarshalField) error {
+			f.Handled = true
+			f.Unclaimed = true
+			value := f.Value
+			f.Finally(func(unclaimed map[string][]byte) error {
+				return f.March.unmarshalRemains(value, unclaimed, &f.in.errs)
+			})
+			return nil
+		},
+	}
+}
+
+// lazyFlag keeps the raw data of a field instead of decoding it, and writes it back as it is.
+func lazyFlag() FlagHandler {
+	return FlagHandler{
+		Marshal: func(f *MarshalField) (err error) {
+			f.Data, err = f.March.marshalRaw(f.Value)
+			return
+		},
+		Read: func(f *UnmarshalField) error {
+			if !f.Found {
+				return nil
+			}
+			f.Handled = true // Decoding is deferred to the user
+			if !f.March.unmarshalRaw(f.Value, f.Data) {
+				return &UnmarshalTypeError{
+					Path:  prependPath("$", fieldStep(f.Descriptor.TagName)),
+					Type:  f.Descriptor.Type,
+					Value: "lazy field",
+					Err:   fmt.Errorf("Lazy field of type %s must be Lazy, *Lazy, RawUnmarshal, json.RawMessage or []byte", f.Descriptor.Type),
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// omitEmptyFlag skips fields with empty values. See IsEmptyValue.
+func omitEmptyFlag() FlagHandler {
+	return FlagHandler{
+		Marshal: func(f *MarshalField) error {
+			if IsEmptyValue(f.Value) {
+				f.Omit = true
+			}
+			return nil
+		},
+	}
+}
+
+// requiredFlag returns a *MissingFieldError for fields which are not present in the input.
+func requiredFlag() FlagHandler {
+	return FlagHandler{
+		Read: func(f *UnmarshalField) error {
+			if f.Found {
+				return nil
+			}
+			return &MissingFieldError{Path: prependPath("$", fieldStep(f.Descriptor.TagName)), Type: f.Descriptor.Type}
+		},
+	}
+}
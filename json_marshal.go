@@ -4,30 +4,36 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
 )
 
-// MarshalAsJSON marshals to JSON via of WriteFieldsJSON.
+// MarshalAsJSON marshals via M.ActiveCodec(), which is JSON by default.
 // v must be a reflect.Value or the value to marshal.
 // Use reflect.ValueOf(v) twice if trying to marshal reflect.Value.
 func (M March) MarshalAsJSON(v interface{}) (data []byte, err error) {
+	if M.Canonical && !M.canonicalizing {
+		return M.marshalCanonical(March.MarshalAsJSON, v)
+	}
 	V, ok := v.(reflect.Value)
 	if !ok {
 		V = reflect.ValueOf(v)
 	}
-	T := V.Type()
+	if !V.IsValid() { // Such as nil
+		return M.ActiveCodec().MarshalScalar(nil)
+	}
 
-	if !M.NoMarshalJSON { // No matter what it is, if it already has a MarshalJSON method
+	if !M.NoMarshalJSON && M.isJSON() { // No matter what it is, if it already has a MarshalJSON method
 		// Then use that instead of the default march JSON marshaler
 		// First, check *T, since having a Un/Marshal methods on the base type is rare
 		pV := ptr(V)
-		data, ok, err = tryMarshal(pV.Type(), pV, "MarshalJSON")
+		data, ok, err = M.tryMarshal(pV, "MarshalJSON")
 		if err != nil || ok {
 			return
 		}
 
 		// Try on the base type, just in case
-		data, ok, err = tryMarshal(T, V, "MarshalJSON")
+		data, ok, err = M.tryMarshal(V, "MarshalJSON")
 		if err != nil || ok {
 			return
 		}
@@ -35,124 +41,275 @@ func (M March) MarshalAsJSON(v interface{}) (data []byte, err error) {
 
 	switch k := V.Kind(); k {
 	case reflect.Slice, reflect.Array:
-		if V.IsNil() {
-			return []byte("[]"), nil
+		if k == reflect.Slice && V.IsNil() {
+			return M.ActiveCodec().WriteSequence(nil)
 		}
 		return M.marshalJSONSlice(V)
-	// case reflect.Map:
-	// TODO implement specific support for custom types under maps
-	// https://golang.org/ref/spec#Map_types
+	case reflect.Map:
+		if V.IsNil() {
+			return M.ActiveCodec().MarshalScalar(nil)
+		}
+		return M.marshalJSONStruct(V)
+	case reflect.Interface:
+		if V.IsNil() {
+			return M.ActiveCodec().MarshalScalar(nil)
+		}
+		return M.Marshal(V.Elem())
 	case reflect.Ptr:
 		if V.IsNil() {
-			return []byte("null"), nil
+			return M.ActiveCodec().MarshalScalar(nil)
 		}
 		V = V.Elem()
 		return M.Marshal(V)
 	case reflect.Struct:
 		return M.marshalJSONStruct(V)
 	default:
-		return json.Marshal(V.Interface())
+		return M.ActiveCodec().MarshalScalar(V.Interface())
 	}
 }
 
+// marshalJSONStruct marshals the fields of a struct, or the entries of a map, as an object
 func (M March) marshalJSONStruct(v reflect.Value) (data []byte, err error) {
-	output := map[string][]byte{}
-	{ // Iterate over all fields
-		values := Values{v}
-		for i := 0; i < values.TotalFields(); i++ {
-			vfield, tfield, ok := values.FieldAt(i, M.TagKey())
-
-			{ // Check for issues
-				if !ok {
-					err = fmt.Errorf("Failed to get field %d/%d from %d values", i, values.TotalFields(), len(values))
-					return
-				}
-
-				if !vfield.CanInterface() {
-					continue
-				}
-			}
+	out := newStructOutput()
+	if err = M.marshalJSONFields(v, out); err != nil {
+		return
+	}
+	output := out.fields
 
-			tag := tfield.TagName
-			if len(tag) <= 0 {
-				continue // The struct did not tell us to write any data from this field
+	{ // Nest the fields with dot notation under their top level names
+		for _, k := range out.paths.keys {
+			var ndata []byte
+			if ndata, err = out.paths.fields[k].encode(M.ActiveCodec()); err != nil {
+				return
 			}
-
-			{ // Check flags
-				if tfield.FlagsContain(FlagHoist) {
-					values = append(values, vfield)
-					continue // Handled later in the loop
-				}
+			if err = M.fieldError(&out.errs, k, out.set(M, k, ndata, 0)); err != nil {
+				return
 			}
+		}
+	}
 
-			output[tag], err = M.Marshal(vfield)
-			if err != nil {
-				if M.Verbose {
-					fmt.Printf("Marshaling field %s: %s", tag, err.Error())
-				}
-				if M.Strict {
-					return
-				}
-				err = nil
+	{ // Perform a second stage for flags which need every other field, such as remains
+		for _, fn := range out.after {
+			if err = fn(output); err != nil {
+				return
 			}
 		}
 	}
 
-	{ // Write out fields using a custom method or the default JSON
+	{ // Write out fields using a custom method or the codec
 		var ok bool
-		data, ok, err = tryWriteFields(v.Type(), v, output, M.WriteFieldsMethodName())
+		data, ok, err = M.tryWriteFields(v, out.names, output, M.WriteFieldsMethodName())
 		if err != nil {
-			err = fmt.Errorf("%s failed: %s%w", M.WriteFieldsMethodName(), err.Error(), err)
 			return
 		}
 		if !ok {
-			// TODO? Prevent marshaling duplicate keys
-			data, err = WriteFieldsJSON(output)
+			data, err = writeFields(M.ActiveCodec(), out.names, output)
 		}
 		if err != nil {
-			err = fmt.Errorf("WriteFieldsJSON failed: %s%w", err.Error(), err)
+			err = fmt.Errorf("WriteFields failed: %s%w", err.Error(), err)
 			return
 		}
 	}
 
+	return data, out.errs.err()
+}
+
+// structOutput collects the output fields of a struct,
+// including the fields of hoisted structs and maps.
+type structOutput struct {
+	fields map[string][]byte
+	names  []string                               // The order of fields, as they are first written or reserved
+	named  map[string]bool                        // The fields in names
+	paths  *pathNode                              // Fields with dot notation tag names
+	after  []func(fields map[string][]byte) error // See MarshalField.After
+	errs   FieldErrors                            // Errors collected when M.Collect is set
+	ranks  map[string]int                         // The rank of each field, see set
+	depth  int                                    // The number of hoists the current fields are within
+}
+
+// rankRemains is the rank of remains entries, which every other field replaces, whatever M.Duplicates is
+const rankRemains = math.MaxInt32
+
+func newStructOutput() *structOutput {
+	return &structOutput{
+		fields: map[string][]byte{},
+		named:  map[string]bool{},
+		paths:  &pathNode{},
+		ranks:  map[string]int{},
+	}
+}
+
+// reserve places a field in the output order, before it is written
+func (out *structOutput) reserve(name string) {
+	if !out.named[name] {
+		out.named[name] = true
+		out.names = append(out.names, name)
+	}
+}
+
+// set writes the data of a top level field, resolving duplicate names with M.Duplicates.
+// A field with a greater rank ranks before those with a lesser rank, regardless of the order they are written in:
+// hoisted fields rank by the number of hoists they are within (so a field ranks after those it hoists).
+// Fields of equal rank rank in the order they are written.
+// Remains entries (rankRemains) are an exception: any other field with the same name replaces them.
+func (out *structOutput) set(M March, name string, data []byte, rank int) error {
+	if _, ok := out.fields[name]; ok {
+		if remains := out.ranks[name] == rankRemains; remains != (rank == rankRemains) {
+			if !remains {
+				return nil // The field already written replaces the remains entry
+			}
+		} else if M.Duplicates == DuplicateError {
+			return &DuplicateFieldError{Path: prependPath("$", fieldStep(name)), Name: name}
+		}
+		if after := rank <= out.ranks[name]; (M.Duplicates == DuplicateFirst) == after {
+			return nil // The field already written wins
+		}
+	}
+	out.reserve(name)
+	out.fields[name] = data
+	out.ranks[name] = rank
+	return nil
+}
+
+// marshalJSONFields marshals the fields of v (a struct or map) into out,
+// passing each through the handlers of its flags. See planFields.
+func (M March) marshalJSONFields(v reflect.Value, out *structOutput) (err error) {
+	fields, err := M.planFields(v)
+	if err != nil {
+		return
+	}
+	for _, pf := range fields {
+		vfield := pf.value
+
+		{ // Check for issues
+			if !vfield.IsValid() || !vfield.CanInterface() {
+				continue
+			}
+		}
+
+		var f *MarshalField
+		f, err = M.flagMarshalField(pf, out)
+		tag := f.Descriptor.TagName
+
+		if err == nil && !f.Omit {
+			fdata := f.Data
+			if fdata == nil {
+				fdata, err = M.Marshal(f.Value)
+				err = withPath(err, fieldStep(tag))
+			}
+			if err == nil || isPartial(err) {
+				if len(f.Descriptor.TagPath) > 1 {
+					if perr := out.paths.insert(f.Descriptor.TagPath, fdata); perr != nil {
+						err = perr
+					} else {
+						out.reserve(f.Descriptor.TagPath[0].Key)
+					}
+				} else if serr := out.set(M, tag, fdata, out.depth); serr != nil {
+					err = serr
+				}
+			}
+		}
+		if err = M.fieldError(&out.errs, tag, err); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// flagMarshalField passes a field through the Marshal hooks of its flags,
+// then marshals any values they hoisted into out, unless the field is omitted.
+func (M March) flagMarshalField(pf planField, out *structOutput) (f *MarshalField, err error) {
+	f = &MarshalField{March: M, Descriptor: pf.descriptor, Value: pf.value, out: out}
+	for _, h := range pf.handlers {
+		if h.Marshal == nil {
+			continue
+		}
+		if err = h.Marshal(f); err != nil {
+			return
+		}
+	}
+	if f.Omit || len(f.hoists) == 0 {
+		return
+	}
+	f.Omit = true // The hoisted fields are written in place of the field
+	out.depth++
+	defer func() { out.depth-- }()
+	for _, v := range f.hoists {
+		if err = M.marshalJSONFields(v, out); err != nil {
+			return
+		}
+	}
 	return
 }
 
 func (M March) marshalJSONSlice(v reflect.Value) (data []byte, err error) {
 	datas := [][]byte{}
 	nested := []byte{}
+	errs := &FieldErrors{}
 	for i := 0; i < v.Len(); i++ {
-		nested, err = M.Marshal(v.Index(i).Interface())
+		nested, err = M.Marshal(v.Index(i)) // Keeping the element type, so that a nil interface is null
+		if err != nil && !isPartial(err) {
+			return nil, withPath(err, indexStep(i))
+		}
 		if err != nil {
-			return
+			errs.add(withPath(err, indexStep(i)))
 		}
 		datas = append(datas, nested)
 	}
-	data = []byte("[")
-	data = append(data, bytes.Join(datas, []byte(","))...)
-	data = append(data, ']')
-
-	return
+	if data, err = M.ActiveCodec().WriteSequence(datas); err != nil {
+		return
+	}
+	return data, errs.err()
 }
 
 // WriteFieldsJSON is the JSON implementation of WriteFields*.
 // It represents a way of encoding the top level of a message
-// into bytes. It is the last stage of marshaling.
+// into bytes. It is the last stage of marshaling. Fields are written in order of their names.
 func WriteFieldsJSON(fields map[string][]byte) (data []byte, err error) {
-	// Set json fields
-	firstField := true
+	return writeFieldsJSON(nil, fields)
+}
+
+// writeFields joins fields into an object with codec, in the order of names where the codec allows.
+// See writeFieldsJSON.
+func writeFields(codec Codec, names []string, fields map[string][]byte) ([]byte, error) {
+	if _, isJSON := codec.(JSONCodec); isJSON {
+		return writeFieldsJSON(names, fields)
+	}
+	return codec.WriteFields(fields)
+}
+
+// writeFieldsJSON writes the fields in the order of names, followed by any fields not in names, in order of their names.
+// Names with no field are skipped.
+func writeFieldsJSON(names []string, fields map[string][]byte) ([]byte, error) {
+	return WriteOrderedFieldsJSON(orderedFields(names, fields))
+}
+
+// WriteOrderedFieldsJSON is like WriteFieldsJSON, but writes the fields in the order given, including any duplicates.
+func WriteOrderedFieldsJSON(fields Fields) (data []byte, err error) {
 	data = []byte("{")
-	for k, v := range fields {
-		if !firstField {
+	for i, f := range fields {
+		if i > 0 {
 			data = append(data, ',')
 		}
-		data = append(data, '"')
-		data = append(data, []byte(k)...)
-		data = append(data, '"')
+		data = appendJSONKey(data, f.Name)
 		data = append(data, ':')
-		data = append(data, v...)
-		firstField = false
+		data = append(data, f.Data...)
 	}
 	data = append(data, '}')
 	return
 }
+
+// appendJSONKey appends key to data as a JSON string, escaped as encoding/json does
+func appendJSONKey(data []byte, key string) []byte {
+	quoted, _ := json.Marshal(key) // Marshaling a string does not fail
+	return append(data, quoted...)
+}
+
+// WriteSequenceJSON is the JSON implementation of WriteSequence.
+// It joins encoded elements into a JSON array.
+func WriteSequenceJSON(elems [][]byte) (data []byte, err error) {
+	data = []byte("[")
+	data = append(data, bytes.Join(elems, []byte(","))...)
+	data = append(data, ']')
+	return
+}
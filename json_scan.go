@@ -0,0 +1,388 @@
+package march
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// A JSON scanner which indexes the byte range of each object member and array element in a document,
+// so that nested values can be read without being decoded again.
+// The document is validated and indexed in a single pass. Member names are only decoded when their object is first read,
+// so the names of values which are never read (such as lazy fields and fields with no tag) are not decoded.
+// It is used by Unmarshal when M.Codec is JSONCodec.
+
+// maxJSONDepth limits the nesting of objects and arrays, as in encoding/json
+const maxJSONDepth = 10000
+
+// jsonIndex holds the composite values of a JSON document by their start offset
+type jsonIndex struct {
+	root    []byte
+	nodes   map[int]*jsonNode
+	scanned int   // The number of objects and arrays scanned, each of which is scanned once
+	err     error // Set if the document is not valid
+}
+
+// jsonNode is a JSON object or array within a document
+type jsonNode struct {
+	end      int
+	isObject bool
+	keySpans [][2]int // The start and end of each member name, including quotes, if isObject
+	keys     []string // Member names, decoded from keySpans when first read
+	spans    [][2]int // The start and end of each member value or element
+}
+
+// newJSONIndex validates data and indexes each of its objects and arrays.
+// If data is not valid JSON, every lookup fails.
+func newJSONIndex(data []byte) *jsonIndex {
+	idx := &jsonIndex{root: data, nodes: map[int]*jsonNode{}}
+	s := &jsonScanner{data: data, nodes: idx.nodes}
+	s.skipSpace()
+	_, err := s.value(0)
+	s.skipSpace()
+	if err == nil && s.pos != len(data) {
+		err = s.errorf("trailing data")
+	}
+	if err != nil {
+		idx.nodes, idx.err = nil, err
+	}
+	idx.scanned = s.scanned
+	return idx
+}
+
+// lookup finds the node for data, which must be a sub-slice of the indexed document
+// (optionally surrounded by whitespace).
+func (idx *jsonIndex) lookup(data []byte) (node *jsonNode, start int, ok bool) {
+	if idx == nil || idx.err != nil {
+		return
+	}
+	if start, ok = idx.offset(data); !ok {
+		return
+	}
+	end := start + len(data)
+	for start < end && isSpace(idx.root[start]) {
+		start++
+	}
+	for end > start && isSpace(idx.root[end-1]) {
+		end--
+	}
+	if node, ok = idx.nodes[start]; !ok {
+		return
+	}
+	if node.end != end {
+		ok = false
+	}
+	return
+}
+
+// offset returns the start of data within the indexed document.
+// Ok is false if data is not a sub-slice of the document.
+func (idx *jsonIndex) offset(data []byte) (start int, ok bool) {
+	if idx == nil || len(data) == 0 || cap(data) > cap(idx.root) {
+		return
+	}
+	start = cap(idx.root) - cap(data)
+	if start >= len(idx.root) || &idx.root[start] != &data[0] {
+		return 0, false // Not part of the same document
+	}
+	return start, true
+}
+
+// fields returns the members of an object node, decoding their names if they have not been already
+func (idx *jsonIndex) fields(node *jsonNode) (map[string][]byte, error) {
+	if len(node.keys) < len(node.keySpans) {
+		keys := make([]string, len(node.keySpans))
+		for i, span := range node.keySpans {
+			s := &jsonScanner{data: idx.root[:span[1]], pos: span[0]}
+			var err error
+			if keys[i], err = s.str(true); err != nil {
+				return nil, err
+			}
+		}
+		node.keys = keys
+	}
+	fields := make(map[string][]byte, len(node.keys))
+	for i, k := range node.keys {
+		fields[k] = idx.root[node.spans[i][0]:node.spans[i][1]]
+	}
+	return fields, nil
+}
+
+// elems returns the elements of an array node
+func (idx *jsonIndex) elems(node *jsonNode) [][]byte {
+	elems := make([][]byte, len(node.spans))
+	for i, span := range node.spans {
+		elems[i] = idx.root[span[0]:span[1]]
+	}
+	return elems
+}
+
+// withIndex returns a copy of M which reads nested JSON from an index of data, see jsonIndex.
+// It has no effect if M already has an index or uses another Codec.
+func (M March) withIndex(data []byte) March {
+	if M.index != nil {
+		return M
+	}
+	if _, ok := M.ActiveCodec().(JSONCodec); ok {
+		M.index = newJSONIndex(data)
+	}
+	return M
+}
+
+// readFields reads the top level fields of data from the index of M, or via the Codec
+func (M March) readFields(data []byte) (map[string][]byte, error) {
+	if node, _, ok := M.index.lookup(data); ok && node.isObject {
+		return M.index.fields(node)
+	}
+	return M.ActiveCodec().ReadFields(data)
+}
+
+// readSequence reads the elements of data from the index of M, or via the Codec
+func (M March) readSequence(data []byte) ([][]byte, error) {
+	if node, _, ok := M.index.lookup(data); ok && !node.isObject {
+		return M.index.elems(node), nil
+	}
+	return M.ActiveCodec().ReadSequence(data)
+}
+
+// jsonScanner validates JSON, recording each object and array in nodes (by its start) unless it is nil
+type jsonScanner struct {
+	data    []byte
+	pos     int
+	nodes   map[int]*jsonNode
+	scanned int // The number of objects and arrays scanned
+}
+
+func (s *jsonScanner) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("offset %d: %s", s.pos, fmt.Sprintf(format, args...))
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func (s *jsonScanner) skipSpace() {
+	for s.pos < len(s.data) && isSpace(s.data[s.pos]) {
+		s.pos++
+	}
+}
+
+// value scans a single value starting at s.pos, and returns its end.
+// Depth is the number of objects and arrays the value is within.
+func (s *jsonScanner) value(depth int) (end int, err error) {
+	if s.pos >= len(s.data) {
+		return 0, s.errorf("unexpected end of input")
+	}
+	switch c := s.data[s.pos]; {
+	case c == '{' || c == '[':
+		if depth >= maxJSONDepth {
+			return 0, s.errorf("exceeded max depth")
+		}
+		s.scanned++
+		var node *jsonNode
+		if s.nodes != nil {
+			node = &jsonNode{}
+			s.nodes[s.pos] = node
+		}
+		if c == '{' {
+			err = s.object(depth+1, node)
+		} else {
+			err = s.array(depth+1, node)
+		}
+		if node != nil {
+			node.end = s.pos
+		}
+	case c == '"':
+		_, err = s.str(false)
+	case c == '-' || (c >= '0' && c <= '9'):
+		err = s.number()
+	case c == 't':
+		err = s.literal("true")
+	case c == 'f':
+		err = s.literal("false")
+	case c == 'n':
+		err = s.literal("null")
+	default:
+		err = s.errorf("invalid character %q looking for beginning of value", c)
+	}
+	return s.pos, err
+}
+
+// object scans an object, recording its members in node unless it is nil
+func (s *jsonScanner) object(depth int, node *jsonNode) (err error) {
+	if node != nil {
+		node.isObject = true
+	}
+	s.pos++ // {
+	s.skipSpace()
+	if s.pos < len(s.data) && s.data[s.pos] == '}' {
+		s.pos++
+		return
+	}
+	for {
+		s.skipSpace()
+		if s.pos >= len(s.data) || s.data[s.pos] != '"' {
+			return s.errorf("expected object key")
+		}
+		kstart := s.pos
+		if _, err = s.str(false); err != nil {
+			return
+		}
+		kend := s.pos
+		s.skipSpace()
+		if s.pos >= len(s.data) || s.data[s.pos] != ':' {
+			return s.errorf("expected colon after object key")
+		}
+		s.pos++
+		s.skipSpace()
+		vstart := s.pos
+		var vend int
+		if vend, err = s.value(depth); err != nil {
+			return
+		}
+		if node != nil {
+			node.keySpans = append(node.keySpans, [2]int{kstart, kend})
+			node.spans = append(node.spans, [2]int{vstart, vend})
+		}
+		s.skipSpace()
+		if s.pos >= len(s.data) {
+			return s.errorf("unexpected end of input in object")
+		}
+		if c := s.data[s.pos]; c == ',' {
+			s.pos++
+			continue
+		} else if c == '}' {
+			s.pos++
+			return
+		}
+		return s.errorf("expected comma or end of object")
+	}
+}
+
+// array scans an array, recording its elements in node unless it is nil
+func (s *jsonScanner) array(depth int, node *jsonNode) (err error) {
+	s.pos++ // [
+	s.skipSpace()
+	if s.pos < len(s.data) && s.data[s.pos] == ']' {
+		s.pos++
+		return
+	}
+	for {
+		s.skipSpace()
+		vstart := s.pos
+		var vend int
+		if vend, err = s.value(depth); err != nil {
+			return
+		}
+		if node != nil {
+			node.spans = append(node.spans, [2]int{vstart, vend})
+		}
+		s.skipSpace()
+		if s.pos >= len(s.data) {
+			return s.errorf("unexpected end of input in array")
+		}
+		if c := s.data[s.pos]; c == ',' {
+			s.pos++
+			continue
+		} else if c == ']' {
+			s.pos++
+			return
+		}
+		return s.errorf("expected comma or end of array")
+	}
+}
+
+// str scans a string, returning its value if decode is set
+func (s *jsonScanner) str(decode bool) (value string, err error) {
+	start := s.pos
+	s.pos++ // "
+	escaped := false
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		switch {
+		case c == '"':
+			s.pos++
+			if !decode {
+				return "", nil
+			}
+			if !escaped {
+				return string(s.data[start+1 : s.pos-1]), nil
+			}
+			err = json.Unmarshal(s.data[start:s.pos], &value)
+			return
+		case c == '\\':
+			escaped = true
+			if s.pos+1 >= len(s.data) {
+				return "", s.errorf("unexpected end of input in string")
+			}
+			switch s.data[s.pos+1] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+				s.pos += 2
+			case 'u':
+				if s.pos+6 > len(s.data) || !isHex(s.data[s.pos+2:s.pos+6]) {
+					return "", s.errorf("invalid unicode escape in string")
+				}
+				s.pos += 6
+			default:
+				return "", s.errorf("invalid escape in string")
+			}
+		case c < 0x20:
+			return "", s.errorf("invalid control character in string")
+		default:
+			s.pos++
+		}
+	}
+	return "", s.errorf("unexpected end of input in string")
+}
+
+func isHex(b []byte) bool {
+	for _, c := range b {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *jsonScanner) digits() int {
+	n := 0
+	for s.pos < len(s.data) && s.data[s.pos] >= '0' && s.data[s.pos] <= '9' {
+		s.pos++
+		n++
+	}
+	return n
+}
+
+func (s *jsonScanner) number() error {
+	if s.data[s.pos] == '-' {
+		s.pos++
+	}
+	if s.pos < len(s.data) && s.data[s.pos] == '0' {
+		s.pos++
+	} else if s.digits() == 0 {
+		return s.errorf("invalid number")
+	}
+	if s.pos < len(s.data) && s.data[s.pos] == '.' {
+		s.pos++
+		if s.digits() == 0 {
+			return s.errorf("invalid number")
+		}
+	}
+	if s.pos < len(s.data) && (s.data[s.pos] == 'e' || s.data[s.pos] == 'E') {
+		s.pos++
+		if s.pos < len(s.data) && (s.data[s.pos] == '+' || s.data[s.pos] == '-') {
+			s.pos++
+		}
+		if s.digits() == 0 {
+			return s.errorf("invalid number")
+		}
+	}
+	return nil
+}
+
+func (s *jsonScanner) literal(lit string) error {
+	if len(s.data)-s.pos < len(lit) || string(s.data[s.pos:s.pos+len(lit)]) != lit {
+		return s.errorf("invalid literal")
+	}
+	s.pos += len(lit)
+	return nil
+}
@@ -6,7 +6,7 @@ import (
 	"reflect"
 )
 
-// UnmarshalAsJSON unmarshals from JSON via of ReadFieldsJSON.
+// UnmarshalAsJSON unmarshals via M.ActiveCodec(), which is JSON by default.
 // v must be either a *reflect.Value or the value to unmarshal.
 func (M March) UnmarshalAsJSON(data []byte, v interface{}) (err error) {
 	pV, ok := v.(*reflect.Value)
@@ -24,24 +24,24 @@ func (M March) UnmarshalAsJSON(data []byte, v interface{}) (err error) {
 	}
 
 	{ // Check if it is a known hardcoded type
-		if T == reflect.TypeOf(RawUnmarshal{}) {
-			V.Set(reflect.ValueOf(toRaw(data, M)))
+		if T == reflect.TypeOf(RawUnmarshal{}) || T == reflect.TypeOf(Lazy{}) {
+			M.unmarshalRaw(V, data)
 			return
 		}
 	}
 
-	if !M.NoUnmarshalJSON { // No matter what V is, if it already has an UnmarshalJSON method
+	if !M.NoUnmarshalJSON && M.isJSON() { // No matter what V is, if it already has an UnmarshalJSON method
 		// Then use that instead of the default march JSON unmarshaler.
 		// First, check *T, since having a Un/Marshal methods on the base type is rare
 		pV := ptr(V)
-		ok, err = tryUnmarshal(pV.Type(), pV, data, "UnmarshalJSON")
+		ok, err = M.tryUnmarshal(pV, data, "UnmarshalJSON")
 		if err != nil || ok {
 			V.Set(pV.Elem())
 			return
 		}
 
 		// Try on the base type, just in case
-		ok, err = tryUnmarshal(T, V, data, "UnmarshalJSON")
+		ok, err = M.tryUnmarshal(V, data, "UnmarshalJSON")
 		if err != nil || ok {
 			return
 		}
@@ -53,150 +53,408 @@ func (M March) UnmarshalAsJSON(data []byte, v interface{}) (err error) {
 			return M.unmarshalJSONPtr(T, V, data)
 		case reflect.Struct:
 			return M.unmarshalJSONStruct(T, V, data)
-		// case reflect.Map:
-		// TODO implement specific support for custom types under maps
-		// https://golang.org/ref/spec#Map_types
+		case reflect.Map:
+			return M.unmarshalJSONMap(T, V, data)
 		case reflect.Array:
-			return fmt.Errorf("Default JSON unmarshaler does not support array types. Use a slice")
+			return M.unmarshalJSONArray(T, V, data)
 		case reflect.Slice:
 			return M.unmarshalJSONSlice(T, V, data)
+		case reflect.Interface:
+			return M.unmarshalJSONInterface(T, V, data)
 		default: // Perform some primitive unmarshaling
-			if V.Type().Kind() == reflect.Interface {
-				V = V.Elem()
-			}
 			return M.unmarshalJSONValue(V.Type(), V, data)
 		}
 	}
 }
 func (M March) unmarshalJSONSlice(t reflect.Type, v reflect.Value, data json.RawMessage) (err error) {
-	elems := []json.RawMessage{}
-	if err = json.Unmarshal(data, &elems); err != nil {
-		return fmt.Errorf("Failed to unmarshal slice: %s%w", err.Error(), err)
+	elems, err := M.readSequence(data)
+	if err != nil {
+		return M.decodeError(t, data, err)
 	}
 
 	elemType := v.Type().Elem()
 	slice := reflect.New(t)
+	errs := &FieldErrors{}
 	{ // (Re)initialize the slice
-		for _, e := range elems {
+		for i, e := range elems {
 			elem := reflect.New(elemType)
 			err = M.Unmarshal(e, &elem)
+			if err != nil && !isPartial(err) {
+				return withPath(err, indexStep(i))
+			}
 			if err != nil {
-				return
+				errs.add(withPath(err, indexStep(i)))
 			}
 			slice.Elem().Set(reflect.Append(slice.Elem(), elem.Elem()))
 		}
 	}
 
 	v.Set(slice.Elem())
+	return errs.err()
+}
+
+// unmarshalJSONInterface unmarshals onto an interface as encoding/json does.
+// If v holds a non-nil pointer, the value it points to is unmarshaled with March.
+// Otherwise, an empty interface receives a generic value (map[string]interface{}, []interface{}, float64, string, bool or nil) from the codec.
+func (M March) unmarshalJSONInterface(t reflect.Type, v reflect.Value, data json.RawMessage) (err error) {
+	if M.isNull(data) {
+		v.Set(reflect.Zero(t))
+		return
+	}
+	if e := v.Elem(); e.Kind() == reflect.Ptr && !e.IsNil() {
+		return M.Unmarshal(data, e.Interface())
+	}
+	if t.NumMethod() > 0 {
+		return &UnmarshalTypeError{Path: "$", Type: t, Value: "value", Err: fmt.Errorf("Cannot unmarshal onto non-empty interface %s", t)}
+	}
+	var generic interface{}
+	if err = M.ActiveCodec().UnmarshalScalar(data, &generic); err != nil {
+		return M.decodeError(t, data, err)
+	}
+	if generic == nil {
+		v.Set(reflect.Zero(t))
+	} else {
+		v.Set(reflect.ValueOf(generic))
+	}
 	return
 }
-func (M March) unmarshalJSONStruct(t reflect.Type, v reflect.Value, data json.RawMessage) (err error) {
-	var input map[string][]byte
-	didUnmarshal := []string{}
-	remainsReceiver := []reflect.Value{}
 
-	{ // Get input fields using a custom method or the default JSON
-		var ok bool
-		input, ok, err = tryReadFields(v.Type(), v, data, M.ReadFieldsMethodName())
-		if err != nil {
-			return fmt.Errorf("%s failed: %s%w", M.ReadFieldsMethodName(), err.Error(), err)
+// unmarshalJSONArray assigns each element of the input to an element of the array v.
+// A sequence of a different length is handled according to M.Arrays.
+func (M March) unmarshalJSONArray(t reflect.Type, v reflect.Value, data json.RawMessage) (err error) {
+	if M.isNull(data) {
+		return // As in encoding/json, null leaves an array untouched
+	}
+	elems, err := M.readSequence(data)
+	if err != nil {
+		return M.decodeError(t, data, err)
+	}
+
+	{ // Check the length
+		if len(elems) > t.Len() && M.Arrays&ArrayTruncate == 0 {
+			return &UnmarshalTypeError{Path: "$", Type: t, Value: "sequence", Err: fmt.Errorf("Sequence of length %d is too long for %s", len(elems), t)}
+		}
+		if len(elems) < t.Len() && M.Arrays&ArrayZeroFill == 0 {
+			return &UnmarshalTypeError{Path: "$", Type: t, Value: "sequence", Err: fmt.Errorf("Sequence of length %d is too short for %s", len(elems), t)}
 		}
-		if !ok {
-			input, err = ReadFieldsJSON(data)
+	}
+
+	array := reflect.New(t).Elem()
+	errs := &FieldErrors{}
+	for i := 0; i < len(elems) && i < t.Len(); i++ {
+		elem := reflect.New(t.Elem())
+		if err = M.Unmarshal(elems[i], &elem); err != nil && !isPartial(err) {
+			return withPath(err, indexStep(i))
 		}
 		if err != nil {
-			return fmt.Errorf("ReadFieldsJSON failed: %s%w", err.Error(), err)
+			errs.add(withPath(err, indexStep(i)))
 		}
+		array.Index(i).Set(elem.Elem())
 	}
+	v.Set(array)
+	return errs.err()
+}
 
-	{ // Iterate over all fields
-		nf := NumField(v)
-		for i := 0; i < nf; i++ {
-			vfield, tfield, ok := NthField(v, i, M.TagKey())
+func (M March) unmarshalJSONStruct(t reflect.Type, v reflect.Value, data json.RawMessage) (err error) {
+	in := &structInput{claimed: map[string]bool{}}
+	if in.fields, err = M.readInput(v, data, &in.errs); err != nil {
+		return
+	}
+	in.paths = newPathReader(M, in.fields)
+	if err = M.unmarshalJSONFields(v, in); err != nil {
+		return
+	}
 
-			{ // Pre checks
-				// Check for reasons to skip this field
-				if !vfield.CanSet() {
-					continue // Unassignable or unexported field
-				}
-				if !ok || !IsValidTagName(tfield.TagName) {
-					continue // The tag lacks a primary value
-				}
+	{ // Perform further stages for flags which need every other field, such as hoisted maps and remains
+		for _, fn := range in.after {
+			if err = fn(in.unclaimed()); err != nil {
+				return
+			}
+		}
+		for _, fn := range in.finally {
+			if err = fn(in.unclaimed()); err != nil {
+				return
+			}
+		}
+	}
+	return in.errs.err()
+}
 
-				if tfield.FlagsContain(FlagRemain) {
-					remainsReceiver = append(remainsReceiver, vfield)
-					continue // Handled in another loop
+// readInput gets the input fields of a struct or map using a custom method or the codec.
+// Errors for repeated names from a custom method are collected in errs if M.Collect is set, see inputFields.
+func (M March) readInput(v reflect.Value, data []byte, errs *FieldErrors) (input map[string][]byte, err error) {
+	fields, ok, err := M.tryReadFields(v, data, M.ReadFieldsMethodName())
+	if err != nil {
+		return
+	}
+	if ok {
+		return M.inputFields(fields, errs)
+	}
+	input, err = M.readFields(data)
+	return input, M.decodeError(v.Type(), data, err)
+}
+
+// inputFields indexes fields by name. Where a name is repeated, M.Duplicates decides which field is used,
+// as when marshaling: the last, the first, or the first with each later one a field error (a *DuplicateFieldError).
+func (M March) inputFields(fields Fields, errs *FieldErrors) (input map[string][]byte, err error) {
+	input = make(map[string][]byte, len(fields))
+	for _, f := range fields {
+		if _, repeated := input[f.Name]; repeated {
+			switch M.Duplicates {
+			case DuplicateFirst:
+				continue
+			case DuplicateError:
+				if err = M.fieldError(errs, f.Name, &DuplicateFieldError{Path: prependPath("$", fieldStep(f.Name)), Name: f.Name}); err != nil {
+					return nil, err
 				}
+				continue
+			}
+		}
+		input[f.Name] = f.Data
+	}
+	return
+}
+
+// unmarshalJSONMap assigns each input field to an entry of the map v,
+// which is allocated if it is nil. Existing entries are kept, as in encoding/json.
+func (M March) unmarshalJSONMap(t reflect.Type, v reflect.Value, data json.RawMessage) (err error) {
+	if M.isNull(data) {
+		v.Set(reflect.Zero(t))
+		return
+	}
+	errs := &FieldErrors{}
+	input, err := M.readInput(v, data, errs)
+	if err != nil {
+		return
+	}
 
-				// Otherwise carry on unmarshaling
-				didUnmarshal = append(didUnmarshal, tfield.TagName)
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(t, len(input)))
+	}
+	for k, edata := range input {
+		var elem reflect.Value
+		if t.Elem().Kind() == reflect.Ptr {
+			elem = reflect.New(t.Elem().Elem())
+		} else {
+			elem = reflect.New(t.Elem()).Elem()
+		}
+		key, kerr := M.unmarshalKey(k, t.Key())
+		if kerr == nil {
+			kerr = M.Unmarshal(edata, &elem)
+		}
+		if kerr != nil {
+			if err = M.fieldError(errs, k, withPath(kerr, fieldStep(k))); err != nil {
+				return
+			}
+			if !isPartial(kerr) {
+				continue
 			}
+		}
+		v.SetMapIndex(key, elem)
+	}
+	return errs.err()
+}
+
+// unmarshalRemains assigns the unclaimed fields of the input to a field with the remains flag.
+// Keys are converted with M.ActiveKeyCodec(), and fields which are not valid keys are skipped unless M.Strict.
+// Errors are collected in errs if M.Collect is set.
+func (M March) unmarshalRemains(value reflect.Value, input map[string][]byte, errs *FieldErrors) (err error) {
+	for k, v := range input {
+		input[k] = append([]byte(nil), v...) // Do not retain the input document
+	}
+	k := value.Kind()
 
-			{ // Unmarshal onto a new value of the same type as field, then assign it
-				ifield, ok := input[tfield.TagName]
-				if !ok {
-					continue // There is no data to put here
+	switch k {
+	case reflect.Map:
+		k, v, _ := mapType(value)
+		var elems reflect.Value
+		{ // Check the type of map
+			switch v {
+			case reflect.TypeOf([]byte{}):
+				elems = reflect.ValueOf(input)
+			case reflect.TypeOf(json.RawMessage{}):
+				elems = reflect.ValueOf(toJSONMap(input))
+			case reflect.TypeOf(RawUnmarshal{}):
+				elems = reflect.ValueOf(toRawMap(input, M))
+			default:
+				panic(fmt.Sprintf("Unmarshal remaining fields onto map with unsupported value type %s", v.Name()))
+			}
+		}
+		if k.Kind() == reflect.String && k == elems.Type().Key() {
+			value.Set(elems)
+			return
+		}
+		remains := reflect.MakeMapWithSize(value.Type(), len(input))
+		for name := range input {
+			key, kerr := M.unmarshalKey(name, k)
+			if kerr != nil {
+				if err = M.fieldError(errs, name, withPath(kerr, fieldStep(name))); err != nil {
+					return
 				}
+				continue
+			}
+			remains.SetMapIndex(key, elems.MapIndex(reflect.ValueOf(name)))
+		}
+		value.Set(remains)
+		return
+	case reflect.Struct, reflect.Array, reflect.Slice:
+		panic(fmt.Sprintf("Unmarshal remaining fields onto unsupported type %s", value.Type().Name()))
+		// Note that support for struct would be rendered obsolete by support for dot notation.
+	default:
+		panic(fmt.Sprintf("Unmarshal remaining fields onto unknown type %s", value.Type().Name()))
+	}
+}
 
-				if tfield.Kind == reflect.Ptr {
-					field := reflect.New(tfield.Type.Elem())
-					err = M.Unmarshal(ifield, &field)
-					vfield.Set(field)
+// structInput tracks the input fields of a struct as they are claimed by
+// its fields, including the fields of hoisted structs.
+type structInput struct {
+	fields  map[string][]byte
+	paths   *pathReader
+	claimed map[string]bool                           // Top level names which belong to a field
+	found   int                                       // The number of fields which were present in the input
+	errs    FieldErrors                               // Errors collected when M.Collect is set
+	after   []func(unclaimed map[string][]byte) error // See UnmarshalField.After
+	finally []func(unclaimed map[string][]byte) error // See UnmarshalField.Finally
+}
+
+// unclaimed returns the input fields which no field has claimed
+func (in *structInput) unclaimed() map[string][]byte {
+	fields := map[string][]byte{}
+	for k, v := range in.fields {
+		if !in.claimed[k] {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// unmarshalJSONFields assigns input fields to the fields of the struct v,
+// passing each through the handlers of its flags.
+func (M March) unmarshalJSONFields(v reflect.Value, in *structInput) (err error) {
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	fields, err := M.planFields(v)
+	if err != nil {
+		return
+	}
+	for _, pf := range fields {
+		vfield, tfield, handlers := pf.value, pf.descriptor, pf.handlers
 
-				} else {
-					field := reflect.New(tfield.Type).Elem()
-					err = M.Unmarshal(ifield, &field)
-					vfield.Set(field)
+		{ // Pre checks
+			if !vfield.IsValid() {
+				// The field is promoted from a nil embedded pointer, which is only allocated if the field is present
+				if _, found, _ := in.paths.read(tfield.TagPath); !found {
+					continue
 				}
+				vfield = fieldByIndex(v, pf.index, true)
+			}
+			// Check for reasons to skip this field
+			if !vfield.IsValid() || !vfield.CanSet() {
+				continue // Unassignable field
+			}
+		}
+
+		f := &UnmarshalField{March: M, Descriptor: tfield, Value: vfield, in: in}
 
-				if err != nil && M.Verbose {
-					fmt.Printf("Error Unmarshaling %s: %s", tfield.TagName, err.Error())
+		{ // Read the input for this field and check flags
+			var perr error
+			f.Data, f.Found, perr = in.paths.read(tfield.TagPath)
+			if perr = M.fieldError(&in.errs, tfield.TagName, withPath(perr, fieldStep(tfield.TagName))); perr != nil {
+				return perr
+			}
+			for _, h := range handlers {
+				if h.Read == nil {
+					continue
 				}
-				if err != nil && M.Strict {
+				if err = M.fieldError(&in.errs, tfield.TagName, h.Read(f)); err != nil {
 					return
 				}
 			}
+			if !f.Unclaimed {
+				in.claimed[tfield.TagPath[0].Key] = true
+				if f.Found {
+					in.found++
+				}
+			}
+			if f.Handled || !f.Found {
+				continue // There is no data to put here, or a flag has dealt with it
+			}
 		}
-	}
 
-	{ // Perform a second stage for the remains flag(s)
-		for _, field := range didUnmarshal {
-			delete(input, field)
-		}
-		for _, value := range remainsReceiver {
-			k := value.Kind()
-
-			switch k {
-			case reflect.Map:
-				k, v, _ := mapType(value)
-				{ // Check the type of map
-					if k.Kind() != reflect.String {
-						panic(fmt.Sprintf("Unmarshal remaining fields onto map with unsupported key type %s", k.Name()))
-					}
-					if v == reflect.TypeOf([]byte{}) {
-						value.Set(reflect.ValueOf(input))
-						continue
-					}
-					if v == reflect.TypeOf(json.RawMessage{}) {
-						value.Set(reflect.ValueOf(toJSONMap(input)))
-						continue
-					}
-					if v == reflect.TypeOf(RawUnmarshal{}) {
-						value.Set(reflect.ValueOf(toRawMap(input, M)))
-						continue
-					}
-					panic(fmt.Sprintf("Unmarshal remaining fields onto map with unsupported value type %s", v.Name()))
+		{ // Unmarshal onto a new value of the same type as field, then assign it
+			ifield := f.Data
+			if tfield.Kind == reflect.Ptr {
+				field := reflect.New(tfield.Type.Elem())
+				err = M.Unmarshal(ifield, &field)
+				vfield.Set(field)
+
+			} else {
+				field := reflect.New(tfield.Type).Elem()
+				if tfield.Kind == reflect.Interface {
+					field.Set(vfield) // Keep a pointer held by the interface
 				}
-			case reflect.Struct, reflect.Array, reflect.Slice:
-				panic(fmt.Sprintf("Unmarshal remaining fields onto unsupported type %s", value.Type().Name()))
-				// Note that support for struct would be rendered obsolete by support for dot notation.
-			default:
-				panic(fmt.Sprintf("Unmarshal remaining fields onto unknown type %s", value.Type().Name()))
+				err = M.Unmarshal(ifield, &field)
+				vfield.Set(field)
+			}
+
+			if err = M.fieldError(&in.errs, tfield.TagName, withPath(err, fieldStep(tfield.TagName))); err != nil {
+				return
 			}
+		}
+
+		{ // Check flags after unmarshaling
+			for _, h := range handlers {
+				if h.Unmarshal == nil {
+					continue
+				}
+				if err = M.fieldError(&in.errs, tfield.TagName, h.Unmarshal(f)); err != nil {
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// unmarshalJSONHoisted assigns input fields to the fields of a hoisted struct,
+// or a pointer to one, which is only allocated if one of its fields is present.
+func (M March) unmarshalJSONHoisted(vfield reflect.Value, in *structInput) (err error) {
+	switch vfield.Kind() {
+	case reflect.Struct:
+		return M.unmarshalJSONFields(vfield, in)
+	case reflect.Ptr:
+		if vfield.Type().Elem().Kind() != reflect.Struct {
+			return
+		}
+		if !vfield.IsNil() {
+			return M.unmarshalJSONFields(vfield.Elem(), in)
+		}
+		// Only allocate the struct if some field was assigned to it
+		found := in.found
+		elem := reflect.New(vfield.Type().Elem())
+		if err = M.unmarshalJSONFields(elem.Elem(), in); err != nil {
+			return
+		}
+		if in.found > found {
+			vfield.Set(elem)
+		}
+	}
+	return
+}
 
+// keepHeldPointers copies each interface field of the struct from which holds a non-nil pointer onto the struct to,
+// so that the value it points to is unmarshaled onto, as by unmarshalJSONInterface.
+func (M March) keepHeldPointers(to, from reflect.Value) {
+	for _, fp := range M.plan(from.Type()).fields {
+		f := fieldByIndex(from, fp.index, false)
+		if !f.IsValid() || f.Kind() != reflect.Interface || f.IsNil() || f.Elem().Kind() != reflect.Ptr || f.Elem().IsNil() {
+			continue
+		}
+		if t := fieldByIndex(to, fp.index, true); t.IsValid() {
+			t.Set(f)
 		}
 	}
-	return nil
 }
 
 func (M March) unmarshalJSONPtr(t reflect.Type, v reflect.Value, data json.RawMessage) (err error) {
@@ -210,7 +468,7 @@ func (M March) unmarshalJSONPtr(t reflect.Type, v reflect.Value, data json.RawMe
 			// Create the value under **v
 			E := reflect.New(ct.Elem())
 			err = M.Unmarshal(data, &E)
-			if err != nil {
+			if err != nil && !isPartial(err) {
 				return
 			}
 			if v.Elem().IsZero() {
@@ -223,8 +481,15 @@ func (M March) unmarshalJSONPtr(t reflect.Type, v reflect.Value, data json.RawMe
 		}
 	}
 	E := reflect.New(ct).Elem()
+	switch ct.Kind() {
+	case reflect.Map, reflect.Interface:
+		E.Set(v.Elem()) // Entries are added to an existing map, and a pointer held by an interface is kept
+	case reflect.Struct:
+		M.keepHeldPointers(E, v.Elem()) // Other fields start from zero
+	}
+
 	err = M.Unmarshal(data, &E)
-	if err != nil {
+	if err != nil && !isPartial(err) {
 		return
 	}
 	v.Elem().Set(E)
@@ -237,9 +502,9 @@ func (M March) unmarshalJSONValue(t reflect.Type, v reflect.Value, data json.Raw
 	fv := reflect.New(t).Interface()
 	{ // Call an unmarshaler
 		var ok bool
-		ok, err = tryUnmarshal(t, reflect.ValueOf(fv), data, M.UnmarshalMethodName())
+		ok, err = M.tryUnmarshal(reflect.ValueOf(fv), data, M.UnmarshalMethodName())
 		if err == nil && !ok {
-			err = json.Unmarshal(data, &fv)
+			err = M.decodeError(t, data, M.ActiveCodec().UnmarshalScalar(data, fv))
 		}
 		if err != nil {
 			return
@@ -271,6 +536,21 @@ func ReadFieldsJSON(data []byte) (fields map[string][]byte, err error) {
 	return
 }
 
+// ReadSequenceJSON is the JSON implementation of ReadSequence.
+// It splits a JSON array into its encoded elements.
+func ReadSequenceJSON(data []byte) (elems [][]byte, err error) {
+	inputs := []json.RawMessage{}
+	err = json.Unmarshal(data, &inputs)
+	if err != nil {
+		return
+	}
+	elems = make([][]byte, len(inputs))
+	for i, elem := range inputs {
+		elems[i] = elem
+	}
+	return
+}
+
 // toJSONMap is just a type casting helper to use map[string][]byte as map[string]json.RawMessage
 func toJSONMap(input map[string][]byte) (output map[string]json.RawMessage) {
 	output = map[string]json.RawMessage{}
@@ -289,8 +569,9 @@ func toRawMap(input map[string][]byte, m March) (output map[string]RawUnmarshal)
 	return
 }
 
-//toRaw is just a type casting helper to use []byte as RawUnmarshal
+// toRaw is just a type casting helper to use []byte as RawUnmarshal
 func toRaw(input []byte, m March) (output RawUnmarshal) {
+	m.index = nil // Do not retain the input document
 	return RawUnmarshal{
 		Bytes: input,
 		March: m,
@@ -0,0 +1,166 @@
+package march
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// KeyCodec converts map keys to and from the names of fields, which are strings.
+type KeyCodec interface {
+	// MarshalKey returns the field name for a map key
+	MarshalKey(key reflect.Value) (name string, err error)
+	// UnmarshalKey returns a map key of type t from a field name
+	UnmarshalKey(name string, t reflect.Type) (key reflect.Value, err error)
+}
+
+// ActiveKeyCodec returns the KeyCodec property on M or a sane default (TextKeyCodec).
+// It should be used instead of M.KeyCodec directly
+func (M March) ActiveKeyCodec() KeyCodec {
+	if M.KeyCodec != nil {
+		return M.KeyCodec
+	}
+	return TextKeyCodec{}
+}
+
+var (
+	typeTextMarshaler   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	typeTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// TextKeyCodec is the default KeyCodec. It supports the key types of encoding/json
+// (strings, integers and encoding.TextMarshaler/TextUnmarshaler), as well as floats, bools and byte arrays.
+// A custom KeyCodec can embed it to handle any other types.
+type TextKeyCodec struct{}
+
+// MarshalKey implements KeyCodec
+func (TextKeyCodec) MarshalKey(key reflect.Value) (name string, err error) {
+	if key.Kind() == reflect.Interface && !key.IsNil() {
+		key = key.Elem()
+	}
+	t := key.Type()
+	switch k := t.Kind(); {
+	case k == reflect.String:
+		return key.String(), nil
+	case t.Implements(typeTextMarshaler):
+		if k == reflect.Ptr && key.IsNil() {
+			return "", nil
+		}
+		var text []byte
+		text, err = key.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	case k >= reflect.Int && k <= reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case k >= reflect.Uint && k <= reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	case k == reflect.Float32 || k == reflect.Float64:
+		return strconv.FormatFloat(key.Float(), 'g', -1, t.Bits()), nil
+	case k == reflect.Bool:
+		return strconv.FormatBool(key.Bool()), nil
+	case k == reflect.Array && t.Elem().Kind() == reflect.Uint8:
+		b := make([]byte, key.Len())
+		reflect.Copy(reflect.ValueOf(b), key)
+		return string(b), nil
+	}
+	return "", fmt.Errorf("Unsupported map key type %s", t)
+}
+
+// UnmarshalKey implements KeyCodec
+func (TextKeyCodec) UnmarshalKey(name string, t reflect.Type) (key reflect.Value, err error) {
+	key = reflect.New(t).Elem()
+	switch k := t.Kind(); {
+	case reflect.PtrTo(t).Implements(typeTextUnmarshaler):
+		err = key.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(name))
+	case k == reflect.String:
+		key.SetString(name)
+	case k >= reflect.Int && k <= reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(name, 10, t.Bits()); err == nil {
+			key.SetInt(n)
+		}
+	case k >= reflect.Uint && k <= reflect.Uintptr:
+		var n uint64
+		if n, err = strconv.ParseUint(name, 10, t.Bits()); err == nil {
+			key.SetUint(n)
+		}
+	case k == reflect.Float32 || k == reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(name, t.Bits()); err == nil {
+			key.SetFloat(f)
+		}
+	case k == reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(name); err == nil {
+			key.SetBool(b)
+		}
+	case k == reflect.Array && t.Elem().Kind() == reflect.Uint8:
+		if len(name) != t.Len() {
+			return key, fmt.Errorf("Map key %q does not have length %d", name, t.Len())
+		}
+		reflect.Copy(key, reflect.ValueOf([]byte(name)))
+	default:
+		err = fmt.Errorf("Unsupported map key type %s", t)
+	}
+	return
+}
+
+// lessKeys compares two map keys of the same type, numerically where that applies.
+// Ok is false if the keys are not numbers or bools.
+func lessKeys(a, b reflect.Value) (less, ok bool) {
+	if a.Type() != b.Type() || a.Type().Implements(typeTextMarshaler) {
+		return
+	}
+	switch k := a.Kind(); {
+	case k >= reflect.Int && k <= reflect.Int64:
+		return a.Int() < b.Int(), true
+	case k >= reflect.Uint && k <= reflect.Uintptr:
+		return a.Uint() < b.Uint(), true
+	case k == reflect.Float32 || k == reflect.Float64:
+		return a.Float() < b.Float(), true
+	case k == reflect.Bool:
+		return !a.Bool() && b.Bool(), true
+	}
+	return
+}
+
+// mapKey is a key of a map, with its field name
+type mapKey struct {
+	key  reflect.Value
+	name string
+}
+
+// sortedKeys returns the keys of the map v with their names from M.ActiveKeyCodec(),
+// ordered as by SortKeys: numbers and bools by value, and other keys by their names.
+func (M March) sortedKeys(v reflect.Value) (keys []mapKey, err error) {
+	keys = make([]mapKey, 0, v.Len())
+	for _, key := range v.MapKeys() {
+		var name string
+		if name, err = M.marshalKey(key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, mapKey{key: key, name: name})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if less, ok := lessKeys(keys[i].key, keys[j].key); ok {
+			return less
+		}
+		return keys[i].name < keys[j].name
+	})
+	return
+}
+
+// marshalKey returns the field name for a map key, using M.ActiveKeyCodec()
+func (M March) marshalKey(key reflect.Value) (string, error) {
+	return M.ActiveKeyCodec().MarshalKey(key)
+}
+
+// unmarshalKey returns a map key of type t from a field name, using M.ActiveKeyCodec()
+// Errors are returned as an *UnmarshalTypeError.
+func (M March) unmarshalKey(name string, t reflect.Type) (key reflect.Value, err error) {
+	if key, err = M.ActiveKeyCodec().UnmarshalKey(name, t); err != nil {
+		err = &UnmarshalTypeError{Path: "$", Type: t, Value: "map key", Err: err}
+	}
+	return
+}
@@ -0,0 +1,97 @@
+package march
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Lazy is a wrapper around RawUnmarshal which defers decoding a field until its value is needed,
+// and caches the decoded value. It is intended for fields with the lazy flag.
+// Lazy is not safe for concurrent use.
+type Lazy struct {
+	RawUnmarshal
+	cached reflect.Value // A pointer to the last decoded value
+}
+
+// Get decodes the raw data onto v, which must be a non-nil pointer.
+// The data is only decoded on the first call for a given type, later calls copy the cached value.
+func (l *Lazy) Get(v interface{}) error {
+	V := reflect.ValueOf(v)
+	if V.Kind() != reflect.Ptr || V.IsNil() {
+		return fmt.Errorf("Lazy.Get requires a non-nil pointer, got %T", v)
+	}
+	if !l.cached.IsValid() || l.cached.Type() != V.Type() {
+		c := reflect.New(V.Type().Elem())
+		if err := l.UnmarshalTo(c.Interface()); err != nil {
+			return err
+		}
+		l.cached = c
+	}
+	V.Elem().Set(l.cached.Elem())
+	return nil
+}
+
+// Set replaces the raw data by marshaling v, and clears the cached value.
+func (l *Lazy) Set(v interface{}) error {
+	data, err := l.March.Marshal(v)
+	if err != nil {
+		return err
+	}
+	l.Bytes = json.RawMessage(data)
+	l.cached = reflect.Value{}
+	return nil
+}
+
+// Decoded indicates whether Get has decoded and cached a value.
+func (l *Lazy) Decoded() bool {
+	return l.cached.IsValid()
+}
+
+// unmarshalRaw assigns data to v without decoding it, if v is one of the raw types
+// which fields with the lazy or remains flags can hold.
+// Ok is false if v is not one of those types.
+func (M March) unmarshalRaw(v reflect.Value, data []byte) (ok bool) {
+	data = append([]byte(nil), data...)
+	switch v.Type() {
+	case reflect.TypeOf(Lazy{}):
+		v.Set(reflect.ValueOf(Lazy{RawUnmarshal: toRaw(data, M)}))
+	case reflect.TypeOf(&Lazy{}):
+		v.Set(reflect.ValueOf(&Lazy{RawUnmarshal: toRaw(data, M)}))
+	case reflect.TypeOf(RawUnmarshal{}):
+		v.Set(reflect.ValueOf(toRaw(data, M)))
+	case reflect.TypeOf(json.RawMessage{}):
+		v.Set(reflect.ValueOf(json.RawMessage(data)))
+	case reflect.TypeOf([]byte{}):
+		v.Set(reflect.ValueOf(data))
+	default:
+		return false
+	}
+	return true
+}
+
+// marshalRaw writes a value of one of the raw types which fields with the lazy
+// or remains flags can hold as it is, and marshals any other value as normal.
+func (M March) marshalRaw(v reflect.Value) (data []byte, err error) {
+	switch raw := v.Interface().(type) {
+	case []byte:
+		data = raw
+	case json.RawMessage:
+		data = raw
+	case RawUnmarshal:
+		data = raw.Bytes
+	case Lazy:
+		data = raw.Bytes
+	case *Lazy:
+		if raw == nil {
+			break
+		}
+		data = raw.Bytes
+	default:
+		return M.Marshal(v)
+	}
+	if len(data) == 0 {
+		return M.ActiveCodec().MarshalScalar(nil)
+	}
+	return
+}
@@ -0,0 +1,151 @@
+package march
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Readers and writers of newline delimited records, AKA NDJSON or JSON Lines.
+
+// LineError describes a record which could not be unmarshaled by a LineReader
+type LineError struct {
+	Line int    // The line number of the record, starting at 1
+	Data []byte // The record
+	Err  error
+}
+
+// Error implements error
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err.Error())
+}
+
+// Unwrap returns the error from unmarshaling the record
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// LineReader reads one record per line from an input stream. Blank lines are skipped.
+type LineReader struct {
+	M March
+	// OnError is called with each record which fails to unmarshal, before moving on to the next.
+	// If M.Strict is set, reading stops at the first bad record instead, and it is returned by Err.
+	OnError func(err *LineError)
+
+	r    *bufio.Reader
+	line int
+	err  error
+}
+
+// NewLineReader provides convenient defaults for March{}.NewLineReader
+func NewLineReader(r io.Reader) *LineReader {
+	return March{}.NewLineReader(r)
+}
+
+// NewLineReader returns a LineReader which reads records from r and unmarshals them with M.
+func (M March) NewLineReader(r io.Reader) *LineReader {
+	return &LineReader{M: M, r: bufio.NewReader(r)}
+}
+
+// Next unmarshals the next good record onto v, which is first reset to its zero value.
+// It returns false at the end of the input, or when reading stops due to an error. See Err.
+//
+//	for lr.Next(&v) {
+//		...
+//	}
+//	if err := lr.Err(); err != nil {
+func (lr *LineReader) Next(v interface{}) bool {
+	for lr.err == nil {
+		data, rerr := lr.r.ReadBytes('\n')
+		if len(data) > 0 {
+			lr.line++
+		}
+		if rerr != nil && rerr != io.EOF {
+			lr.err = rerr
+			return false
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			if rerr == io.EOF {
+				return false
+			}
+			continue
+		}
+
+		err := lr.unmarshal(data, v)
+		if err == nil {
+			return true
+		}
+		lerr := &LineError{Line: lr.line, Data: data, Err: err}
+		if lr.M.Strict {
+			lr.err = lerr
+			return false
+		}
+		if lr.OnError != nil {
+			lr.OnError(lerr)
+		}
+		if rerr == io.EOF {
+			return false
+		}
+	}
+	return false
+}
+
+func (lr *LineReader) unmarshal(data []byte, v interface{}) error {
+	if V := reflect.ValueOf(v); V.Kind() == reflect.Ptr && !V.IsNil() {
+		V.Elem().Set(reflect.Zero(V.Elem().Type()))
+	}
+	return lr.M.Unmarshal(data, v)
+}
+
+// Err returns the error which stopped the reader, if any.
+// This is either an error from the input stream, or a *LineError when M.Strict is set.
+func (lr *LineReader) Err() error {
+	return lr.err
+}
+
+// Line returns the line number of the last record read
+func (lr *LineReader) Line() int {
+	return lr.line
+}
+
+// LineWriter writes one record per line to an output stream.
+type LineWriter struct {
+	M March
+
+	w io.Writer
+}
+
+// NewLineWriter provides convenient defaults for March{}.NewLineWriter
+func NewLineWriter(w io.Writer) *LineWriter {
+	return March{}.NewLineWriter(w)
+}
+
+// NewLineWriter returns a LineWriter which marshals records with M and writes them to w.
+func (M March) NewLineWriter(w io.Writer) *LineWriter {
+	return &LineWriter{M: M, w: w}
+}
+
+// Write marshals v and writes it as a single line, terminated by a newline.
+// When using JSONCodec, the record is compacted so that it has no embedded newlines.
+// A record from another Codec which contains a newline is an error.
+func (lw *LineWriter) Write(v interface{}) (err error) {
+	data, err := lw.M.Marshal(v)
+	if err != nil {
+		return
+	}
+	if _, isJSON := lw.M.ActiveCodec().(JSONCodec); isJSON {
+		buf := &bytes.Buffer{}
+		if err = json.Compact(buf, data); err != nil {
+			return fmt.Errorf("Invalid record: %s%w", err.Error(), err)
+		}
+		data = buf.Bytes()
+	} else if bytes.ContainsAny(data, "\r\n") {
+		return fmt.Errorf("Record contains a newline")
+	}
+	_, err = lw.w.Write(append(data, '\n'))
+	return
+}
@@ -0,0 +1,31 @@
+package march
+
+import "log"
+
+// Logger receives messages about field errors when M.Verbose is set. *log.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// ActiveLogger returns the Logger property on M or a sane default (the standard logger of package log).
+// It should be used instead of M.Logger directly
+func (M March) ActiveLogger() Logger {
+	if M.Logger != nil {
+		return M.Logger
+	}
+	return stdLogger{}
+}
+
+// stdLogger writes to the standard logger of package log
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+// logf writes a message to M.ActiveLogger() if M.Verbose is set
+func (M March) logf(format string, v ...interface{}) {
+	if M.Verbose {
+		M.ActiveLogger().Printf(format, v...)
+	}
+}
@@ -12,17 +12,64 @@ const FlagRemain = "remains"
 // FlagHoist denotes a type whose values are hoisted to the parent struct when marshaling to JSON
 const FlagHoist = "hoist"
 
+// FlagLazy denotes a field whose raw data is kept, to be decoded later.
+// The field must be one of Lazy, *Lazy, RawUnmarshal, json.RawMessage or []byte.
+const FlagLazy = "lazy"
+
+// FlagOmitEmpty denotes a field which is not marshaled when it holds an empty value
+const FlagOmitEmpty = "omitempty"
+
+// FlagRequired denotes a field which must be present in the input when unmarshaling, or a *MissingFieldError is returned
+const FlagRequired = "required"
+
+// ArrayPolicy determines how arrays are unmarshaled from sequences of a different length.
+// The policies can be combined, so that ArrayTruncate|ArrayZeroFill behaves like encoding/json.
+type ArrayPolicy int
+
+// Array policies. The zero value returns an error for any difference in length.
+const (
+	ArrayTruncate ArrayPolicy = 1 << iota // Elements beyond the length of the array are ignored
+	ArrayZeroFill                         // Elements missing from the sequence are left as zero values
+)
+
+// DuplicatePolicy determines which field is written when several fields of an object have the same name.
+// Fields rank in the order they are declared, followed by fields with dot notation.
+// Hoisted fields rank before the fields of the struct which hoists them, so by default a field replaces the hoisted fields of the same name.
+// The policy does not apply to remains entries, which tagged and hoisted fields always replace.
+// The policy also decides which input field is used where Fields from a ReadFieldsX method repeat a name.
+type DuplicatePolicy int
+
+// Duplicate policies
+const (
+	DuplicateLast  DuplicatePolicy = iota // The last field with the name is written
+	DuplicateFirst                        // The first field with the name is written
+	DuplicateError                        // Later fields with the name are field errors (a *DuplicateFieldError)
+)
+
 // March is the top level interface for Un/Marshaling
 type March struct {
 	// TODO construct and make .tag private to avoid confusion with defaults
 	Tag                string                            // The tag key to look up on structs
 	Suffix             string                            // An optional override for custom functions eg. MarshalSUFFIX. Defaults to Tag
-	NoMarshalJSON      bool                              // Prevents the default MarshalAsJSON method from trying to use MarshalJSON
-	NoUnmarshalJSON    bool                              // Prevents the default UnmarshalAsJSON method from trying to use UnmarshalJSON
-	Verbose            bool                              // Used in some cases to show field un/marshaling errors
+	NoMarshalJSON      bool                              // Prevents the default MarshalAsJSON method from trying to use MarshalJSON, which it only tries with JSONCodec
+	NoUnmarshalJSON    bool                              // Prevents the default UnmarshalAsJSON method from trying to use UnmarshalJSON, which it only tries with JSONCodec
+	Verbose            bool                              // Used in some cases to show field un/marshaling errors, via Logger
 	Strict             bool                              // Determines whether a failure to un/marshal a field results in a failure overall
+	Collect            bool                              // Un/marshal every other field after a failure, then return a *FieldErrors listing them all. Overrides Strict
+	Logger             Logger                            // Receives messages when Verbose. Defaults to the standard logger of package log
+	NoRecover          bool                              // Lets panics propagate from Marshal and Unmarshal, for debugging, instead of returning a *PanicError
 	DefaultMarshaler   func(interface{}) ([]byte, error) // Override the default marshaler for types with no custom marshal function
 	DefaultUnmarshaler func([]byte, interface{}) error   // Override the default unmarshaler for types with no custom unmarshal function
+	Codec              Codec                             // The wire format used by the default un/marshalers. Defaults to JSONCodec
+	Flags              map[string]FlagHandler            // Custom flag handlers, see HandleFlag
+	StrictSignatures   bool                              // Return a SignatureError for custom methods with the wrong signature, instead of ignoring them
+	KeyCodec           KeyCodec                          // Converts map keys to and from field names. Defaults to TextKeyCodec
+	Arrays             ArrayPolicy                       // How arrays are unmarshaled from sequences of a different length. Defaults to an error
+	Duplicates         DuplicatePolicy                   // Which field is marshaled when several have the same name. Defaults to the last
+	Canonical          bool                              // Marshal JSON in the canonical form of RFC 8785, for signing and hashing. See CanonicalJSON
+
+	index          *jsonIndex // The document being unmarshaled, indexed as it is read. See withIndex
+	canonicalizing bool       // Set within a value which is canonicalized as a whole. See marshalCanonical
 }
 
 // RawUnmarshal is a wrapper around json.RawMessage which
@@ -78,6 +125,10 @@ func Unmarshal(data []byte, v interface{}) (err error) {
 // by default in JSON, or by a custom marshal method if one exists on
 // the given type.
 func (M March) Marshal(v interface{}) (data []byte, err error) {
+	if M.Canonical && !M.canonicalizing {
+		return M.marshalCanonical(March.Marshal, v)
+	}
+	defer M.recoverPanic(v, &err)
 	{ // Sanity check
 		if !IsValidTagName(M.TagKey()) {
 			err = fmt.Errorf("Malformed tag")
@@ -87,17 +138,16 @@ func (M March) Marshal(v interface{}) (data []byte, err error) {
 
 	{ // Check the target type
 		V, isValue := v.(reflect.Value)
-		var T reflect.Type
-		if isValue {
-			T = V.Type()
-		} else {
+		if !isValue {
 			V = reflect.ValueOf(v)
-			T = reflect.TypeOf(v)
+		}
+		if !V.IsValid() { // Such as nil
+			return M.ActiveCodec().MarshalScalar(nil)
 		}
 
 		// Check if there is a method to call instead
 		var ok bool
-		data, ok, err = tryMarshal(T, V, M.MarshalMethodName())
+		data, ok, err = M.tryMarshal(V, M.MarshalMethodName())
 		if err != nil || ok {
 			return
 		}
@@ -108,7 +158,7 @@ func (M March) Marshal(v interface{}) (data []byte, err error) {
 
 // MarshalDefault represents the absence of a MarshalX method
 // (where X is determined by the March instance). It is the "sane default"
-// of marshalers, and is based on JSON.
+// of marshalers, and is based on M.ActiveCodec() (JSON by default).
 func (M March) MarshalDefault(v interface{}) (data []byte, err error) {
 	if M.DefaultMarshaler != nil {
 		return M.DefaultMarshaler(v)
@@ -121,19 +171,26 @@ func (M March) MarshalDefault(v interface{}) (data []byte, err error) {
 // By default in JSON, or by a custom unmarshal method if one exists on
 // the given type.
 func (M March) Unmarshal(data []byte, v interface{}) (err error) {
+	defer M.recoverPanic(v, &err)
 	// Sanity check
 	if !IsValidTagName(M.TagKey()) {
 		return fmt.Errorf("Malformed tag")
 	}
+	M = M.withIndex(data)
 
 	{ // Check the type of v
 		V, isValue := v.(reflect.Value)
-		var T reflect.Type
-		if isValue {
-			T = V.Type()
-		} else {
+		if !isValue {
 			V = reflect.ValueOf(v)
-			T = reflect.TypeOf(v)
+		}
+		// A value to set, as passed by the default unmarshalers for fields, elements and entries.
+		// Its methods are looked up on a pointer to it, as for the top level value &v,
+		// so that an UnmarshalX method is found whether it has a value or pointer receiver.
+		if pV, ok := v.(*reflect.Value); ok {
+			V, isValue = *pV, true
+			if V.Kind() != reflect.Ptr && V.CanAddr() {
+				V = V.Addr()
+			}
 		}
 		kind := V.Kind()
 		if kind != reflect.Ptr && !isValue {
@@ -142,7 +199,7 @@ func (M March) Unmarshal(data []byte, v interface{}) (err error) {
 
 		// Check if there is a method to call instead
 		var ok bool
-		ok, err = tryUnmarshal(T, V, data, M.UnmarshalMethodName())
+		ok, err = M.tryUnmarshal(V, data, M.UnmarshalMethodName())
 		if err != nil || ok {
 			return
 		}
@@ -153,7 +210,7 @@ func (M March) Unmarshal(data []byte, v interface{}) (err error) {
 
 // UnmarshalDefault represents the absence of an UnmarshalX method
 // (where X is determined by the March instance). It is the "sane default"
-// of unmarshalers, and is based on a JSON implementation of ReadFields.
+// of unmarshalers, and is based on M.ActiveCodec() (JSON by default).
 func (M March) UnmarshalDefault(data []byte, v interface{}) (err error) {
 	if M.DefaultUnmarshaler != nil {
 		return M.DefaultUnmarshaler(data, v)
@@ -0,0 +1,132 @@
+package march
+
+import "reflect"
+
+// Field is a single named, encoded field of an object
+type Field struct {
+	Name string
+	Data []byte
+}
+
+// Fields is an ordered list of the encoded fields of an object, which keeps the order they are written in and any repeated names.
+// It can be used in place of map[string][]byte by ReadFieldsX and WriteFieldsX methods:
+//
+//	func (T) ReadFieldsX(data []byte) (march.Fields, error)
+//	func (T) WriteFieldsX(fields march.Fields) ([]byte, error)
+//
+// Iterate over the fields with range.
+type Fields []Field
+
+// FieldsFromMap returns the fields of a map in SortKeys order
+func FieldsFromMap(m map[string][]byte) Fields {
+	return orderedFields(nil, m)
+}
+
+// Get returns the data of the first field with the given name. Ok is false if there is no such field.
+func (fs Fields) Get(name string) (data []byte, ok bool) {
+	for _, f := range fs {
+		if f.Name == name {
+			return f.Data, true
+		}
+	}
+	return
+}
+
+// Values returns the data of every field with the given name, in order
+func (fs Fields) Values(name string) (values [][]byte) {
+	for _, f := range fs {
+		if f.Name == name {
+			values = append(values, f.Data)
+		}
+	}
+	return
+}
+
+// Add appends a field, even if one with the same name exists
+func (fs *Fields) Add(name string, data []byte) {
+	*fs = append(*fs, Field{Name: name, Data: data})
+}
+
+// Set replaces the first field with the given name and removes any others,
+// or appends a field if there is none.
+func (fs *Fields) Set(name string, data []byte) {
+	set := false
+	kept := (*fs)[:0]
+	for _, f := range *fs {
+		if f.Name == name {
+			if set {
+				continue
+			}
+			f.Data, set = data, true
+		}
+		kept = append(kept, f)
+	}
+	*fs = kept
+	if !set {
+		fs.Add(name, data)
+	}
+}
+
+// Delete removes every field with the given name
+func (fs *Fields) Delete(name string) {
+	kept := (*fs)[:0]
+	for _, f := range *fs {
+		if f.Name != name {
+			kept = append(kept, f)
+		}
+	}
+	*fs = kept
+}
+
+// Names returns the name of each field once, in order
+func (fs Fields) Names() (names []string) {
+	seen := map[string]bool{}
+	for _, f := range fs {
+		if !seen[f.Name] {
+			seen[f.Name] = true
+			names = append(names, f.Name)
+		}
+	}
+	return
+}
+
+// Duplicates returns the names which appear more than once, in order
+func (fs Fields) Duplicates() (names []string) {
+	count := map[string]int{}
+	for _, f := range fs {
+		if count[f.Name]++; count[f.Name] == 2 {
+			names = append(names, f.Name)
+		}
+	}
+	return
+}
+
+// Map returns the fields as a map. Of fields with the same name, the last is kept, as in encoding/json.
+func (fs Fields) Map() map[string][]byte {
+	m := make(map[string][]byte, len(fs))
+	for _, f := range fs {
+		m[f.Name] = f.Data
+	}
+	return m
+}
+
+// orderedFields returns the fields of m in the order of names, followed by any not in names, in SortKeys order.
+// Names with no field are skipped.
+func orderedFields(names []string, m map[string][]byte) Fields {
+	fs := make(Fields, 0, len(m))
+	added := make(map[string]bool, len(m))
+	for _, name := range names {
+		if data, ok := m[name]; ok && !added[name] {
+			added[name] = true
+			fs.Add(name, data)
+		}
+	}
+	if len(added) < len(m) {
+		for _, key := range SortKeys(reflect.ValueOf(m).MapKeys()) {
+			if name := key.String(); !added[name] {
+				fs.Add(name, m[name])
+			}
+		}
+	}
+	return fs
+}
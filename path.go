@@ -0,0 +1,198 @@
+package march
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Utilities for dealing with dot notation in tag names: `March:"data.v"`, `March:"list[0]"`
+
+// PathStep is one step of a tag name path, being either a Key in an object
+// or an Index in a sequence.
+type PathStep struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
+
+// String returns the step as it would appear in a tag name
+func (ps PathStep) String() string {
+	if ps.IsIndex {
+		return fmt.Sprintf("[%d]", ps.Index)
+	}
+	return ps.Key
+}
+
+// ParseTagPath splits a tag name into the steps of its path.
+// Names are split on `.` and `[N]`, so that `data.list[0].v` has four steps.
+// A name which is not a valid path (such as `a..b` or `a[x]`) is returned as a single Key step.
+func ParseTagPath(name string) (path []PathStep) {
+	whole := []PathStep{{Key: name}}
+	if !strings.ContainsAny(name, ".[") {
+		return whole
+	}
+	for _, part := range strings.Split(name, ".") {
+		key := part
+		indexes := ""
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			key, indexes = part[:i], part[i:]
+		}
+		if len(key) == 0 {
+			return whole // Every part must start with a key, so `a.[0]` and `[0]` are not paths
+		}
+		path = append(path, PathStep{Key: key})
+		for len(indexes) > 0 {
+			end := strings.IndexByte(indexes, ']')
+			if indexes[0] != '[' || end < 0 {
+				return whole
+			}
+			n, err := strconv.Atoi(indexes[1:end])
+			if err != nil || n < 0 {
+				return whole
+			}
+			path = append(path, PathStep{Index: n, IsIndex: true})
+			indexes = indexes[end+1:]
+		}
+	}
+	return path
+}
+
+// pathNode is a tree of encoded values which is built up from flat fields with
+// path tag names, then encoded as nested objects and sequences.
+type pathNode struct {
+	leaf   []byte
+	isLeaf bool
+	isSeq  bool
+	fields map[string]*pathNode
+	keys   []string // The keys of fields, in the order they were inserted
+	elems  []*pathNode
+}
+
+// insert stores data at the given path below the node
+func (n *pathNode) insert(path []PathStep, data []byte) error {
+	if len(path) == 0 {
+		if n.isLeaf || n.fields != nil || n.elems != nil {
+			return fmt.Errorf("Path is assigned more than once")
+		}
+		n.isLeaf = true
+		n.leaf = data
+		return nil
+	}
+	if n.isLeaf {
+		return fmt.Errorf("Path is assigned a value and also has children")
+	}
+	step := path[0]
+	if step.IsIndex {
+		if n.fields != nil {
+			return fmt.Errorf("Path is used as both object and sequence")
+		}
+		n.isSeq = true
+		for len(n.elems) <= step.Index {
+			n.elems = append(n.elems, nil)
+		}
+		if n.elems[step.Index] == nil {
+			n.elems[step.Index] = &pathNode{}
+		}
+		return n.elems[step.Index].insert(path[1:], data)
+	}
+	if n.isSeq {
+		return fmt.Errorf("Path is used as both object and sequence")
+	}
+	if n.fields == nil {
+		n.fields = map[string]*pathNode{}
+	}
+	child, ok := n.fields[step.Key]
+	if !ok {
+		child = &pathNode{}
+		n.fields[step.Key] = child
+		n.keys = append(n.keys, step.Key)
+	}
+	return child.insert(path[1:], data)
+}
+
+// encode writes the node and its children using the given Codec.
+// Gaps in sequences are encoded as nil.
+func (n *pathNode) encode(codec Codec) (data []byte, err error) {
+	if n == nil {
+		return codec.MarshalScalar(nil)
+	}
+	if n.isLeaf {
+		return n.leaf, nil
+	}
+	if n.isSeq {
+		elems := make([][]byte, len(n.elems))
+		for i, e := range n.elems {
+			if elems[i], err = e.encode(codec); err != nil {
+				return
+			}
+		}
+		return codec.WriteSequence(elems)
+	}
+	fields := map[string][]byte{}
+	for k, f := range n.fields {
+		if fields[k], err = f.encode(codec); err != nil {
+			return
+		}
+	}
+	return writeFields(codec, n.keys, fields)
+}
+
+// pathReader resolves paths against the top level fields of a message,
+// reading each nested object or sequence at most once.
+type pathReader struct {
+	M      March
+	fields map[string]map[string][]byte
+	elems  map[string][][]byte
+}
+
+func newPathReader(M March, input map[string][]byte) *pathReader {
+	return &pathReader{
+		M:      M,
+		fields: map[string]map[string][]byte{"": input},
+		elems:  map[string][][]byte{},
+	}
+}
+
+// read returns the encoded value at the given path.
+// Ok is false if the path (or any part of it) is absent.
+func (pr *pathReader) read(path []PathStep) (data []byte, ok bool, err error) {
+	prefix := ""
+	for i, step := range path {
+		if i > 0 {
+			if step.IsIndex {
+				elems, cached := pr.elems[prefix]
+				if !cached {
+					if elems, err = pr.M.readSequence(data); err != nil {
+						return nil, false, fmt.Errorf("Reading %s: %s%w", prefix, err.Error(), err)
+					}
+					pr.elems[prefix] = elems
+				}
+				if step.Index >= len(elems) {
+					return nil, false, nil
+				}
+				data = elems[step.Index]
+				prefix += step.String()
+				continue
+			}
+			if _, cached := pr.fields[prefix]; !cached {
+				fields, rerr := pr.M.readFields(data)
+				if rerr != nil {
+					return nil, false, fmt.Errorf("Reading %s: %s%w", prefix, rerr.Error(), rerr)
+				}
+				pr.fields[prefix] = fields
+			}
+		} else if step.IsIndex {
+			return nil, false, nil
+		}
+		data, ok = pr.fields[prefix][step.Key]
+		if !ok {
+			return nil, false, nil
+		}
+		if i > 0 {
+			prefix += "."
+		}
+		prefix += step.Key
+	}
+	return data, true, nil
+}
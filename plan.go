@@ -0,0 +1,212 @@
+package march
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Plans are the compiled form of struct types, so that tags are only parsed
+// (and, without custom flag handlers, flag handlers only looked up) once per type, rather than on every call.
+
+// planKey identifies a typePlan by its type and tag key
+type planKey struct {
+	t   reflect.Type
+	tag string
+}
+
+// typePlan lists the tagged fields of a struct type
+type typePlan struct {
+	fields []fieldPlan
+	stream bool // Whether fields can be written one at a time, see streamable
+}
+
+// fieldPlan is a single tagged field of a struct, with its parsed tag and the handlers of its flags
+type fieldPlan struct {
+	index      []int  // The field, through any embedded structs. See reflect.Value.FieldByIndex
+	name       string // The Go name of the field, such as Embed.Field
+	depth      int    // The number of embedded structs the field is promoted through
+	descriptor FieldDescriptor
+	handlers   []FlagHandler
+}
+
+// basePlanCache stores the []fieldPlan of each planKey before flags are described, which does not depend on M.Flags.
+// planCache stores the complete *typePlan of each planKey for instances with no custom flag handlers.
+var basePlanCache, planCache sync.Map
+
+// plan returns the compiled plan for the struct type t, building it on first use.
+// Custom flag handlers (M.Flags) can be registered at any time, so with any registered,
+// the handlers are looked up on each call, and only the parsed tags are cached.
+func (M March) plan(t reflect.Type) *typePlan {
+	key := planKey{t: t, tag: M.TagKey()}
+	if len(M.Flags) == 0 {
+		if cached, ok := planCache.Load(key); ok {
+			return cached.(*typePlan)
+		}
+	}
+
+	base, ok := basePlanCache.Load(key)
+	if !ok {
+		fields := []fieldPlan{}
+		M.planStruct(t, nil, "", map[reflect.Type]bool{}, &fields)
+		base, _ = basePlanCache.LoadOrStore(key, fields)
+	}
+
+	p := &typePlan{}
+	for _, fp := range base.([]fieldPlan) {
+		fp.descriptor.TagFlags = append([]string(nil), fp.descriptor.TagFlags...) // Describe may change them
+		fp.descriptor, fp.handlers = M.describe(fp.descriptor)
+		p.fields = append(p.fields, fp)
+	}
+	p.fields = dominantFields(p.fields)
+	p.stream = M.streamable(p)
+
+	if len(M.Flags) == 0 {
+		cached, _ := planCache.LoadOrStore(key, p)
+		return cached.(*typePlan)
+	}
+	return p
+}
+
+// planStruct appends the tagged fields of the struct type t to fields,
+// including the fields of untagged embedded structs (and pointers to them), which are promoted.
+func (M March) planStruct(t reflect.Type, index []int, prefix string, visited map[reflect.Type]bool, fields *[]fieldPlan) {
+	if visited[t] {
+		return // Embedded in itself
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		findex := append(append([]int{}, index...), i)
+		fd, ok := FieldDescriptorFromStructField(sf, M.TagKey())
+		if sf.Anonymous && (!ok || !IsValidTagName(fd.TagName)) {
+			et := sf.Type
+			if et.Kind() == reflect.Ptr {
+				if len(sf.PkgPath) > 0 {
+					continue // An unexported pointer can not be allocated
+				}
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct {
+				M.planStruct(et, findex, prefix+sf.Name+".", visited, fields)
+			}
+			continue
+		}
+		if len(sf.PkgPath) > 0 {
+			continue // Unexported fields can not be un/marshaled
+		}
+		if !ok || !IsValidTagName(fd.TagName) {
+			continue // The tag lacks a primary value
+		}
+		*fields = append(*fields, fieldPlan{index: findex, name: prefix + sf.Name, depth: len(index), descriptor: fd})
+	}
+}
+
+// dominantFields applies Go's rules to promoted fields which share a tag name:
+// the field with the fewest embeddings wins, and fields which tie are all dropped.
+// Fields of the struct itself are never dropped, even if they share a name.
+// Neither are hoist and remains fields, whose tag names are not written (and are often all _).
+func dominantFields(fields []fieldPlan) (dominant []fieldPlan) {
+	unnamed := func(fp fieldPlan) bool {
+		return fp.descriptor.FlagsContain(FlagHoist) || fp.descriptor.FlagsContain(FlagRemain)
+	}
+	depths := map[string][]int{} // The depths at which each name occurs
+	for _, fp := range fields {
+		if !unnamed(fp) {
+			depths[fp.descriptor.TagName] = append(depths[fp.descriptor.TagName], fp.depth)
+		}
+	}
+	for _, fp := range fields {
+		if unnamed(fp) {
+			dominant = append(dominant, fp)
+			continue
+		}
+		ties := 0
+		shallower := false
+		for _, d := range depths[fp.descriptor.TagName] {
+			if d < fp.depth {
+				shallower = true
+			} else if d == fp.depth {
+				ties++
+			}
+		}
+		if shallower || (fp.depth > 0 && ties > 1) {
+			continue
+		}
+		dominant = append(dominant, fp)
+	}
+	return
+}
+
+// fieldByIndex returns the field of v at index, or an invalid Value if it is
+// reached through a nil pointer. If alloc is set, nil pointers are allocated instead.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// streamable indicates whether the fields of a plan can be encoded one at a time by an Encoder.
+// This is not the case if any field has a dot notation path, shares its name with another field,
+// or has a flag whose handler needs the other fields (such as hoist and remains).
+func (M March) streamable(p *typePlan) bool {
+	names := map[string]bool{}
+	for _, fp := range p.fields {
+		fd := fp.descriptor
+		if len(fd.TagPath) > 1 || names[fd.TagName] {
+			return false
+		}
+		names[fd.TagName] = true
+		for _, flag := range fd.TagFlags {
+			if _, custom := M.Flags[flag]; custom || flag == FlagHoist || flag == FlagRemain {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// planField is a field of a value, along with its plan
+type planField struct {
+	value reflect.Value // Invalid if the field is reached through a nil embedded pointer
+	fieldPlan
+}
+
+// planFields lists the tagged fields of v, which may be a struct,
+// or a map whose entries are treated as fields, named and ordered by M.ActiveKeyCodec() (see sortedKeys).
+func (M March) planFields(v reflect.Value) (fields []planField, err error) {
+	switch v.Kind() {
+	case reflect.Struct:
+		p := M.plan(v.Type())
+		fields = make([]planField, len(p.fields))
+		for i, fp := range p.fields {
+			fields[i] = planField{value: fieldByIndex(v, fp.index, false), fieldPlan: fp}
+		}
+	case reflect.Map:
+		var keys []mapKey
+		if keys, err = M.sortedKeys(v); err != nil {
+			return
+		}
+		for i, key := range keys {
+			fd, _ := FieldDescriptorFromMap(v, key.key, M.TagKey())
+			fd.TagName = key.name
+			fd.TagPath = []PathStep{{Key: fd.TagName}}
+			fields = append(fields, planField{
+				value:     v.MapIndex(key.key),
+				fieldPlan: fieldPlan{index: []int{i}, descriptor: fd},
+			})
+		}
+	}
+	return
+}
@@ -0,0 +1,257 @@
+package march
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Encoders and Decoders read and write a stream of values, like those of encoding/json.
+
+// Encoder writes values to an output stream.
+type Encoder struct {
+	M March
+	w io.Writer
+}
+
+// NewEncoder provides convenient defaults for March{}.NewEncoder
+func NewEncoder(w io.Writer) *Encoder {
+	return March{}.NewEncoder(w)
+}
+
+// NewEncoder returns an Encoder which marshals values with M and writes them to w.
+func (M March) NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{M: M, w: w}
+}
+
+// Encode marshals v and writes it to the stream, followed by a newline.
+// When using JSONCodec, the fields of structs and the elements of slices are written as they are
+// marshaled, rather than being collected first. Types which need all of their fields at once
+// (custom WriteFieldsX methods, dot notation, hoist and remains) are marshaled as a whole and then written.
+// If an error is returned, part of the value may already have been written.
+// When M.Strict is not set, a field which fails is skipped, as by Marshal, unless part of it has already
+// been written out (such as the elements of a long slice before one which fails), in which case the error is returned.
+// When M.Collect is set, values are marshaled as a whole, and a value with a *FieldErrors is still written.
+// When M.Canonical is set, values are marshaled as a whole, then canonicalized.
+func (enc *Encoder) Encode(v interface{}) (err error) {
+	M := enc.M
+	if !IsValidTagName(M.TagKey()) {
+		return fmt.Errorf("Malformed tag")
+	}
+	V, isValue := v.(reflect.Value)
+	if !isValue {
+		V = reflect.ValueOf(v)
+	}
+	e := &encodeState{w: enc.w}
+	if err = M.encode(e, V); err != nil && !isPartial(err) {
+		return
+	}
+	e.write([]byte{'\n'})
+	if ferr := e.flush(true); ferr != nil {
+		return ferr
+	}
+	return
+}
+
+// encodeBufferSize is the amount of output which an encodeState holds before writing it out
+const encodeBufferSize = 4096
+
+// encodeState buffers the output of an Encoder.
+type encodeState struct {
+	w       io.Writer
+	buf     []byte
+	flushed int // The number of bytes written out before buf
+}
+
+func (e *encodeState) write(data []byte) {
+	e.buf = append(e.buf, data...)
+}
+
+// flush writes out the buffer if it is full, or if all is set
+func (e *encodeState) flush(all bool) (err error) {
+	if len(e.buf) == 0 || (!all && len(e.buf) < encodeBufferSize) {
+		return
+	}
+	_, err = e.w.Write(e.buf)
+	e.flushed += len(e.buf)
+	e.buf = e.buf[:0]
+	return
+}
+
+// offset returns the number of bytes written to e, including those not yet written out
+func (e *encodeState) offset() int {
+	return e.flushed + len(e.buf)
+}
+
+// discard removes the bytes written since offset, if they have not been written out yet.
+// Ok is false if some have been.
+func (e *encodeState) discard(offset int) (ok bool) {
+	if offset < e.flushed {
+		return false
+	}
+	e.buf = e.buf[:offset-e.flushed]
+	return true
+}
+
+// encode writes v to e with the same precedence as Marshal
+func (M March) encode(e *encodeState, v reflect.Value) (err error) {
+	defer M.recoverPanic(v, &err)
+	if !M.isJSON() || M.DefaultMarshaler != nil || M.Collect || M.Canonical || !v.IsValid() {
+		return M.encodeWhole(e, v)
+	}
+
+	{ // Check if there is a method to call instead
+		data, ok, err := M.tryMarshal(v, M.MarshalMethodName())
+		if err != nil || ok {
+			e.write(data)
+			return err
+		}
+	}
+
+	if !M.NoMarshalJSON { // As in MarshalAsJSON
+		data, ok, err := M.tryMarshal(ptr(v), "MarshalJSON")
+		if err == nil && !ok {
+			data, ok, err = M.tryMarshal(v, "MarshalJSON")
+		}
+		if err != nil || ok {
+			e.write(data)
+			return err
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return M.encodeWhole(e, v)
+		}
+		return M.encodeSlice(e, v)
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return M.encodeWhole(e, v)
+		}
+		return M.encode(e, v.Elem())
+	case reflect.Struct:
+		if _, found, _ := findMethod(v.Type(), writeFieldsSignature(M.WriteFieldsMethodName())); found || !M.plan(v.Type()).stream {
+			return M.encodeWhole(e, v)
+		}
+		return M.encodeStruct(e, v)
+	default:
+		return M.encodeWhole(e, v)
+	}
+}
+
+// encodeWhole marshals v and writes the result, including a value with a *FieldErrors (see M.Collect)
+func (M March) encodeWhole(e *encodeState, v reflect.Value) error {
+	data, err := M.Marshal(v)
+	if err != nil && !isPartial(err) {
+		return err
+	}
+	e.write(data)
+	return err
+}
+
+// encodeSlice writes each element of v as it is marshaled, as in marshalJSONSlice
+func (M March) encodeSlice(e *encodeState, v reflect.Value) (err error) {
+	e.write([]byte{'['})
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			e.write([]byte{','})
+		}
+		if err = M.encode(e, v.Index(i)); err != nil {
+			return withPath(err, indexStep(i))
+		}
+		if err = e.flush(false); err != nil {
+			return
+		}
+	}
+	e.write([]byte{']'})
+	return
+}
+
+// encodeStruct writes each field of v as it is marshaled, as in marshalJSONFields.
+// The plan of v must be streamable.
+func (M March) encodeStruct(e *encodeState, v reflect.Value) (err error) {
+	e.write([]byte{'{'})
+	first := true
+	fields, err := M.planFields(v)
+	if err != nil {
+		return
+	}
+	for _, pf := range fields {
+		if !pf.value.IsValid() || !pf.value.CanInterface() {
+			continue
+		}
+
+		var f *MarshalField
+		f, err = M.flagMarshalField(pf, newStructOutput())
+		tag := f.Descriptor.TagName
+
+		mark := e.offset()
+		if err == nil && !f.Omit {
+			if !first {
+				e.write([]byte{','})
+			}
+			e.write(append(appendJSONKey(nil, tag), ':'))
+			if f.Data != nil {
+				e.write(f.Data)
+			} else {
+				err = withPath(M.encode(e, f.Value), fieldStep(tag))
+			}
+			if err == nil {
+				first = false
+			}
+		}
+		if err != nil {
+			M.logf("Field %s: %s", tag, err.Error())
+			if _, ok := err.(*PanicError); ok || M.Strict {
+				return
+			}
+			if !e.discard(mark) {
+				return // Part of the field has been written out, so it can not be skipped
+			}
+			err = nil
+		}
+		if err = e.flush(false); err != nil {
+			return
+		}
+	}
+	e.write([]byte{'}'})
+	return
+}
+
+// Decoder reads values from an input stream.
+type Decoder struct {
+	M   March
+	dec *json.Decoder
+}
+
+// NewDecoder provides convenient defaults for March{}.NewDecoder
+func NewDecoder(r io.Reader) *Decoder {
+	return March{}.NewDecoder(r)
+}
+
+// NewDecoder returns a Decoder which reads values from r and unmarshals them with M.
+// The stream is split into values as JSON, which may be concatenated or separated by whitespace,
+// so M must use JSONCodec.
+func (M March) NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{M: M, dec: json.NewDecoder(r)}
+}
+
+// Decode reads the next value from the stream and unmarshals it onto v.
+// It returns io.EOF when there are no more values, or an error when dec.M does not use JSONCodec.
+func (dec *Decoder) Decode(v interface{}) error {
+	if !dec.M.isJSON() {
+		return fmt.Errorf("Decoder requires JSONCodec to split the stream into values")
+	}
+	var data json.RawMessage
+	if err := dec.dec.Decode(&data); err != nil {
+		return err
+	}
+	return dec.M.Unmarshal(data, v)
+}
+
+// More reports whether there is another value in the stream
+func (dec *Decoder) More() bool {
+	return dec.dec.More()
+}
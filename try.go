@@ -3,6 +3,7 @@ package march
 import (
 	"fmt"
 	"reflect"
+	"sync"
 )
 
 // TagKey returns the Tag property on M or a sane default
@@ -55,151 +56,196 @@ func ptr(v reflect.Value) reflect.Value {
 	return pv
 }
 
-// tryMarshal attempts to call a custom unmarshal method on the given type/value
-func tryMarshal(t reflect.Type, v reflect.Value, method string) (data []byte, ok bool, err error) {
-	if v.IsZero() && v.Kind() == reflect.Ptr {
-		ok = false
-		return
+// SignatureError is returned when a custom method exists on a type,
+// but does not match the signature March expects. See March.StrictSignatures.
+type SignatureError struct {
+	Type   reflect.Type
+	Method string
+	Got    string // The signature of the method, excluding the receiver
+	Want   string // The expected signature
+}
+
+// Error implements error
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("%s.%s has signature %s, expected %s", e.Type, e.Method, e.Got, e.Want)
+}
+
+// methodKey identifies a method by name on a type, for methodCache
+type methodKey struct {
+	t    reflect.Type
+	name string
+}
+
+// methodInfo is the cached result of looking up and checking a method
+type methodInfo struct {
+	method reflect.Method
+	found  bool
+	err    error
+}
+
+// methodCache stores the methodInfo for each methodKey, so that signatures
+// are only checked once per type.
+var methodCache sync.Map
+
+// findMethod looks up the method named by sig on t and checks its signature.
+// Found is false if there is no such method, and err is a *SignatureError if its signature does not match.
+func findMethod(t reflect.Type, sig signature) (m reflect.Method, found bool, err error) {
+	key := methodKey{t: t, name: sig.name}
+	if cached, ok := methodCache.Load(key); ok {
+		info := cached.(methodInfo)
+		return info.method, info.found, info.err
 	}
-	data, ok, err = callMarshal(t, v, method, []reflect.Value{v})
-	if err != nil || ok {
-		return
+	m, found = t.MethodByName(sig.name)
+	if found && !sig.matches(m.Type) {
+		err = &SignatureError{Type: t, Method: sig.name, Got: methodString(m.Type), Want: sig.String()}
 	}
-	V := reflect.New(v.Type())
-	T := V.Type()
-	V.Elem().Set(v)
-	return callMarshal(T, V, method, []reflect.Value{V})
+	methodCache.Store(key, methodInfo{method: m, found: found, err: err})
+	return
 }
-func callMarshal(t reflect.Type, v reflect.Value, method string, args []reflect.Value) (data []byte, ok bool, err error) {
-	var res []reflect.Value
-	res, ok = TryCall(t, v, method, args)
-	if !ok {
+
+// callMethod calls the method named by sig on v with the given args.
+// Ok is false if there is no such method. A method with the wrong signature
+// is ignored, or returns a *SignatureError if M.StrictSignatures is set.
+func (M March) callMethod(v reflect.Value, sig signature, args ...reflect.Value) (res []reflect.Value, ok bool, err error) {
+	if !v.IsValid() {
 		return
 	}
-	// TODO replace this with calls to NumIn/NumOut/In/Out
-	if len(res) != 2 {
-		panic(fmt.Sprintf("Implementation of %s returned %d values, wanted 2", method, len(res)))
-	}
-	var eok, dok bool
-
-	d := res[0].Interface()
-	data, dok = d.([]byte)
-	if !dok {
-		err = fmt.Errorf("%s implementation returned non map[string][]byte value as first result: %T", method, d)
+	var m reflect.Method
+	m, ok, err = findMethod(v.Type(), sig)
+	if !ok {
+		return
 	}
-
-	ferr := res[1].Interface()
-	err, eok = ferr.(error)
-	if !eok && err != nil {
-		err = fmt.Errorf("%s implementation returned non error/nil value as second result: %T", method, ferr)
+	if err != nil {
+		if !M.StrictSignatures {
+			return nil, false, nil
+		}
+		return
 	}
-
+	res = m.Func.Call(append([]reflect.Value{v}, args...))
 	return
 }
 
-// tryUnmarshal attempts to call a custom unmarshal method on the given type/value
-// It will first check for a the specified method on *v and create a new pointer to v if needed.
-func tryUnmarshal(t reflect.Type, v reflect.Value, data []byte, method string) (ok bool, err error) {
-	return tryCallAndGetError(t, v, method, []reflect.Value{
-		v,
-		reflect.ValueOf(data),
-	})
+// tryMarshal attempts to call a custom marshal method on the given value, or a pointer to it
+func (M March) tryMarshal(v reflect.Value, method string) (data []byte, ok bool, err error) {
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		ok = false
+		return
+	}
+	data, ok, err = M.callMarshal(v, method)
+	if err != nil || ok {
+		return
+	}
+	return M.callMarshal(ptr(v), method)
 }
 
-// tryReadFields attempts to call a custom input field getter method on the given type/value
-func tryReadFields(t reflect.Type, v reflect.Value, data []byte, method string) (fields map[string][]byte, ok bool, err error) {
+func (M March) callMarshal(v reflect.Value, method string) (data []byte, ok bool, err error) {
 	var res []reflect.Value
-	res, ok = TryCall(t, v, method, []reflect.Value{
-		v,
-		reflect.ValueOf(data),
-	})
-	if !ok {
+	res, ok, err = M.callMethod(v, marshalSignature(method))
+	if !ok || err != nil {
 		return
 	}
-	// TODO replace this with calls to NumIn/NumOut/In/Out
-	if len(res) != 2 {
-		panic(fmt.Sprintf("Implementation of %s returned %d values, wanted 2", method, len(res)))
-	}
-	var eok, fok bool
+	return bytesResult(res[0]), ok, methodError(v, method, errorResult(res[1]))
+}
 
-	f := res[0].Interface()
-	fields, fok = f.(map[string][]byte)
-	if !fok {
-		err = fmt.Errorf("%s implementation returned non map[string][]byte value as first result: %T", method, f)
+// tryUnmarshal attempts to call a custom unmarshal method on the given value
+func (M March) tryUnmarshal(v reflect.Value, data []byte, method string) (ok bool, err error) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return
 	}
-
-	ferr := res[1].Interface()
-	err, eok = ferr.(error)
-	if !eok && err != nil {
-		err = fmt.Errorf("%s implementation returned non error/nil value as second result: %T", method, ferr)
+	var res []reflect.Value
+	res, ok, err = M.callMethod(v, unmarshalSignature(method), reflect.ValueOf(data))
+	if !ok || err != nil {
+		return
 	}
-
-	return
+	return ok, methodError(v, method, errorResult(res[0]))
 }
 
-// tryWriteFields attempts to call a custom output field setter method on the given type/value
-func tryWriteFields(t reflect.Type, v reflect.Value, fields map[string][]byte, method string) (data []byte, ok bool, err error) {
+// tryReadFields attempts to call a custom input field getter method on the given value.
+// A map result is converted to Fields, in no particular order.
+func (M March) tryReadFields(v reflect.Value, data []byte, method string) (fields Fields, ok bool, err error) {
 	var res []reflect.Value
-	res, ok = TryCall(t, v, method, []reflect.Value{
-		v,
-		reflect.ValueOf(data),
-	})
-	if !ok {
+	res, ok, err = M.callMethod(v, readFieldsSignature(method), reflect.ValueOf(data))
+	if !ok || err != nil {
 		return
 	}
-	// TODO replace this with calls to NumIn/NumOut/In/Out
-	if len(res) != 2 {
-		panic(fmt.Sprintf("Implementation of %s returned %d values, wanted 2", method, len(res)))
+	switch {
+	case res[0].IsNil():
+	case res[0].Type().ConvertibleTo(typeFields):
+		for name, data := range res[0].Convert(typeFields).Interface().(map[string][]byte) {
+			fields = append(fields, Field{Name: name, Data: data})
+		}
+	default:
+		fields = res[0].Convert(typeOrderedFields).Interface().(Fields)
 	}
-	var eok, dok bool
+	return fields, ok, methodError(v, method, errorResult(res[1]))
+}
 
-	d := res[0].Interface()
-	data, dok = d.([]byte)
-	if !dok {
-		err = fmt.Errorf("%s implementation returned non []byte value as first result: %T", method, d)
+// tryWriteFields attempts to call a custom output field setter method on the given value.
+// A method which takes Fields receives them in the order of names (see orderedFields).
+func (M March) tryWriteFields(v reflect.Value, names []string, fields map[string][]byte, method string) (data []byte, ok bool, err error) {
+	arg := reflect.ValueOf(fields)
+	if v.IsValid() {
+		m, found, serr := findMethod(v.Type(), writeFieldsSignature(method))
+		if found && serr == nil && m.Type.NumIn() == 2 && !typeFields.AssignableTo(m.Type.In(1)) {
+			arg = reflect.ValueOf(orderedFields(names, fields))
+		}
+	}
+	var res []reflect.Value
+	res, ok, err = M.callMethod(v, writeFieldsSignature(method), arg)
+	if !ok || err != nil {
+		return
 	}
+	return bytesResult(res[0]), ok, methodError(v, method, errorResult(res[1]))
+}
 
-	ferr := res[1].Interface()
-	err, eok = ferr.(error)
-	if !eok && err != nil {
-		err = fmt.Errorf("%s implementation returned non error/nil value as second result: %T", method, ferr)
+// methodError wraps an error returned by the named method of v in a *MethodError
+func methodError(v reflect.Value, method string, err error) error {
+	if err == nil {
+		return nil
 	}
+	return &MethodError{Path: "$", Type: v.Type(), Method: method, Err: err}
+}
 
-	return
+// bytesResult converts a result which matched typeBytes (such as json.RawMessage) to []byte
+func bytesResult(v reflect.Value) []byte {
+	return v.Convert(typeBytes).Interface().([]byte)
 }
 
-// tryCallAndGetError attempts to call a method on the given type/value
-// It expects that the function will return one value.
-// The returned value must be err or nil.
-// If err is nil and ok is true, then the call succeeded.
-// If err is nil and ok is false, no method was found.
-// If err is not nil then an attempt was made to call the method,
-// which failed or returned an unexpected result.
-func tryCallAndGetError(t reflect.Type, v reflect.Value, method string, args []reflect.Value) (ok bool, err error) {
-	var res []reflect.Value
-	res, ok = TryCall(t, v, method, args)
-	if !ok {
-		return
-	}
-	if len(res) != 1 {
-		err = fmt.Errorf("%s implementation returned %d values, expected one error", method, len(res))
-	}
-	var eok bool
-	first := res[0].Interface()
-	err, eok = first.(error)
-	if !eok && err != nil {
-		err = fmt.Errorf("%s implementation returned non error/nil value as first result: %T", method, first)
+// errorResult converts a result which matched typeError to error
+func errorResult(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		if v.IsNil() {
+			return nil
+		}
 	}
-	return
+	return v.Convert(typeError).Interface().(error)
 }
 
 // TryCall attempts to make a call on a reflected type/value with provided args
 // Returns the result of the call (if any) as reflect.Values and ok to indicate if the method was found.
+// Ok is also false if the method does not accept the given args.
 func TryCall(t reflect.Type, v reflect.Value, method string, args []reflect.Value) (res []reflect.Value, ok bool) {
 	var m reflect.Method
 	m, ok = t.MethodByName(method)
+	if ok && !canCall(m.Type, args) {
+		ok = false
+	}
 	if ok {
 		res = m.Func.Call(args)
 	}
 	return
 }
+
+// canCall indicates whether a func of type ft can be called with args
+func canCall(ft reflect.Type, args []reflect.Value) bool {
+	if ft.IsVariadic() || ft.NumIn() != len(args) {
+		return false
+	}
+	for i, arg := range args {
+		if !arg.IsValid() || !arg.Type().AssignableTo(ft.In(i)) {
+			return false
+		}
+	}
+	return true
+}
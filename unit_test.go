@@ -2,6 +2,7 @@ package march
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -137,3 +138,239 @@ func TestUnmarshalPtrUninitialized(t *testing.T) {
 		}
 	}
 }
+
+func TestParseTagPath(t *testing.T) {
+	for name, want := range map[string]string{
+		"v":              "v",
+		"data.v":         "data/v",
+		"list[0]":        "list/[0]",
+		"a.b[1][2].c":    "a/b/[1]/[2]/c",
+		"a..b":           "a..b",
+		"[0]":            "[0]",
+		"a[x]":           "a[x]",
+		"a[1":            "a[1",
+		"a.[1]":          "a.[1]",
+		"with spaces.ok": "with spaces/ok",
+	} {
+		steps := []string{}
+		for _, step := range ParseTagPath(name) {
+			steps = append(steps, step.String())
+		}
+		if got := strings.Join(steps, "/"); got != want {
+			t.Fatalf("ParseTagPath(%q): got %s, expected %s.", name, got, want)
+		}
+	}
+}
+
+type planned struct {
+	A int `March:"a,omitempty" B:"b"`
+	B int `B:"b2"`
+	c int `March:"c"`
+}
+
+func TestPlanCache(t *testing.T) {
+	m := March{}
+	T := reflect.TypeOf(planned{})
+	p := m.plan(T)
+	if got := len(p.fields); got != 1 {
+		t.Fatalf("Got %d fields, expected %d.", got, 1)
+	}
+	if fd := p.fields[0].descriptor; fd.TagName != "a" || !fd.FlagsContain(FlagOmitEmpty) || len(p.fields[0].handlers) != 1 {
+		t.Fatalf("Unexpected plan for field: %#v", p.fields[0])
+	}
+	if m.plan(T) != p {
+		t.Fatalf("Plan was not cached")
+	}
+	if (March{Tag: "B"}).plan(T) == p {
+		t.Fatalf("Plan was shared between tag keys")
+	}
+	m.HandleFlag("custom", FlagHandler{})
+	if m.plan(T) == p {
+		t.Fatalf("Plan was shared between flag handlers")
+	}
+
+	{ // Handlers registered after a plan is used replace those in it
+		m := March{}
+		m.HandleFlag("custom", FlagHandler{})
+		if data, err := m.Marshal(planned{A: 1}); err != nil || string(data) != `{"a":1}` {
+			t.Fatalf("Unexpected output %s (%v)", string(data), err)
+		}
+		m.HandleFlag(FlagOmitEmpty, FlagHandler{Marshal: func(f *MarshalField) error {
+			f.Data = []byte(`2`)
+			return nil
+		}})
+		if data, err := m.Marshal(planned{A: 1}); err != nil || string(data) != `{"a":2}` {
+			t.Fatalf("Stale plan gave %s (%v)", string(data), err)
+		}
+	}
+
+	{ // Plans are safe for concurrent use
+		done := make(chan error)
+		for i := 0; i < 8; i++ {
+			go func(i int) {
+				m := March{}
+				data, err := m.Marshal(planned{A: i})
+				if err == nil {
+					err = m.Unmarshal(data, &planned{})
+				}
+				done <- err
+			}(i)
+		}
+		for i := 0; i < 8; i++ {
+			if err := <-done; err != nil {
+				t.Fatalf("Unexpected error: %s", err.Error())
+			}
+		}
+	}
+}
+
+func TestJSONIndex(t *testing.T) {
+	data := []byte(` {"a": [1, {"b": "x\"y"}, []], "c": {}, "d": null} `)
+	m := March{}.withIndex(data)
+	fields, err := m.readFields(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	want, _ := ReadFieldsJSON(data)
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("Got %q, expected %q.", fields, want)
+	}
+	if len(m.index.nodes) != 5 {
+		t.Fatalf("Indexed %d nodes, expected every object and array", len(m.index.nodes))
+	}
+	if _, _, ok := m.index.lookup(fields["a"]); !ok {
+		t.Fatalf("Nested array was not indexed")
+	}
+	elems, err := m.readSequence(fields["a"])
+	if err != nil || len(elems) != 3 || string(elems[1]) != `{"b": "x\"y"}` {
+		t.Fatalf("Unexpected elements %q (%v)", elems, err)
+	}
+	if node, _, ok := m.index.lookup(elems[1]); !ok || node.keys != nil {
+		t.Fatalf("Member names were decoded before they were read")
+	}
+	if inner, err := m.readFields(elems[1]); err != nil || string(inner["b"]) != `"x\"y"` {
+		t.Fatalf("Unexpected fields %q (%v)", inner, err)
+	}
+
+	{ // Data from outside the document is read by the Codec
+		other := []byte(`{"a": 1}`)
+		if _, _, ok := m.index.lookup(other); ok {
+			t.Fatalf("Found data from another document")
+		}
+		if fields, err := m.readFields(other); err != nil || string(fields["a"]) != "1" {
+			t.Fatalf("Unexpected fields %q (%v)", fields, err)
+		}
+	}
+
+	{ // Each object and array of a deep document is scanned once, however deeply it is read
+		depth := 1000
+		deep := []byte(strings.Repeat(`{"a":[`, depth) + `1` + strings.Repeat(`]}`, depth))
+		m := March{}.withIndex(deep)
+		var v interface{}
+		if err := m.Unmarshal(deep, &v); err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		for i := 0; i < depth; i++ {
+			v = v.(map[string]interface{})["a"].([]interface{})[0]
+		}
+		if v != 1.0 || m.index.scanned != 2*depth {
+			t.Fatalf("Got %v after scanning %d objects and arrays, expected 1 after %d", v, m.index.scanned, 2*depth)
+		}
+	}
+
+	{ // Invalid documents are not indexed, so the Codec reports the error
+		deep := `{"a":1,"b":` + strings.Repeat("[", maxJSONDepth+1) + strings.Repeat("]", maxJSONDepth+1) + `}`
+		for _, bad := range []string{`{"a": 1`, `{"a": 1} x`, `{"a": 01}`, `["\x"]`, `{a: 1}`, deep} {
+			m := March{}.withIndex([]byte(bad))
+			if _, _, ok := m.index.lookup(m.index.root); ok || m.index.err == nil {
+				t.Fatalf("Indexed invalid document %.20s", bad)
+			}
+		}
+	}
+}
+
+func TestSortKeys(t *testing.T) {
+	for _, test := range []struct {
+		m    interface{}
+		want string
+	}{
+		{map[int]bool{10: true, 2: true, -1: true}, "-1 2 10"},
+		{map[uint8]bool{200: true, 30: true}, "30 200"},
+		{map[float32]bool{2.5: true, -0.5: true, 10: true}, "-0.5 2.5 10"},
+		{map[bool]bool{true: true, false: true}, "false true"},
+		{map[string]bool{"b": true, "a": true, "ab": true}, "a ab b"},
+		{map[[2]byte]bool{{'b', 'a'}: true, {'a', 'b'}: true}, "ab ba"},
+	} {
+		keys := []string{}
+		for _, k := range SortKeys(reflect.ValueOf(test.m).MapKeys()) {
+			keys = append(keys, string(KeyToBytes(k)))
+		}
+		if got := strings.Join(keys, " "); got != test.want {
+			t.Fatalf("Got %s, expected %s.", got, test.want)
+		}
+	}
+}
+
+func TestWriteFieldsJSON(t *testing.T) {
+	data, err := WriteFieldsJSON(map[string][]byte{`a"b`: []byte("1"), `c\d`: []byte("2"), "e\nf": []byte("3")})
+	if err != nil {
+		t.Fatalf("WriteFieldsJSON Error: %s", err.Error())
+	}
+	if want := `{"a\"b":1,"c\\d":2,"e\nf":3}`; string(data) != want {
+		t.Fatalf("Got %s, expected %s", string(data), want)
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	for _, test := range []struct{ in, want string }{
+		// Numbers from RFC 8785, appendix B
+		{`0`, `0`},
+		{`-0`, `0`},
+		{`5e-324`, `5e-324`},
+		{`1.7976931348623157e308`, `1.7976931348623157e+308`},
+		{`-1.7976931348623157e308`, `-1.7976931348623157e+308`},
+		{`9007199254740992`, `9007199254740992`},
+		{`-9007199254740992`, `-9007199254740992`},
+		{`295147905179352830000`, `295147905179352830000`},
+		{`9.999999999999997e22`, `9.999999999999997e+22`},
+		{`1e23`, `1e+23`},
+		{`1e21`, `1e+21`},
+		{`1e20`, `100000000000000000000`},
+		{`0.000001`, `0.000001`},
+		{`1e-7`, `1e-7`},
+		{`333333333.33333329`, `333333333.3333333`},
+		{`1.0`, `1`},
+		{`-12.50`, `-12.5`},
+		{`1.0e2`, `100`},
+		{`9007199254740993.5`, `9007199254740994`}, // Not an integer, so rounded
+		// Strings, from RFC 8785, section 3.2.2.2
+		{`"\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/"`, `"€$\u000f\nA'B\"\\\\\"/"`},
+		{`"<&>\u2028"`, "\"<&>\u2028\""},
+		{`"\\ud800\"\ud83d\ude00"`, "\"\\\\ud800\\\"😀\""}, // An escaped backslash, then a pair
+		// Names sorted by UTF-16 code units, from RFC 8785, section 3.2.3
+		{
+			`{"\u20ac": "Euro Sign", "\r": "Carriage Return", "\ufb33": "Hebrew Letter Dalet With Dagesh", "1": "One", "\ud83d\ude00": "Emoji: Grinning Face", "\u0080": "Control", "\u00f6": "Latin Small Letter O With Diaeresis"}`,
+			"{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"ö\":\"Latin Small Letter O With Diaeresis\",\"€\":\"Euro Sign\",\"😀\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		},
+		{` { "b" : [ 1 , { "d" : true, "c" : null } ] , "a" : "" } `, `{"a":"","b":[1,{"c":null,"d":true}]}`},
+	} {
+		got, err := CanonicalJSON([]byte(test.in))
+		if err != nil {
+			t.Fatalf("CanonicalJSON(%s) Error: %s", test.in, err.Error())
+		}
+		if string(got) != test.want {
+			t.Fatalf("CanonicalJSON(%s): Got %s, expected %s", test.in, string(got), test.want)
+		}
+	}
+	for _, bad := range []string{
+		`{"a":1,"a":2}`, `1e400`, `[1,]`, `{} {}`, ``,
+		// Integers which float64 can not hold exactly
+		`9007199254740993`, `-9007199254740993`, `[9.007199254740993e15]`, `{"n":123456789012345678901}`,
+		// Lone surrogates and invalid UTF-8
+		`"\ud800"`, `"\udc00"`, `"a\ud800\u0041"`, `"\ud83d"`, `{"\ude00":1}`, "\"\xff\"", "\"\xed\xa0\x80\"",
+	} {
+		if got, err := CanonicalJSON([]byte(bad)); err == nil {
+			t.Fatalf("CanonicalJSON(%s): Expected an error, got %s", bad, string(got))
+		}
+	}
+}